@@ -12,6 +12,7 @@ var qs = window.location.search.substring(1).split('&').reduce(function (a, e) {
 
 if (qs['token']) {
   localStorage.setItem('idToken', qs['token']);
+  localStorage.removeItem('refreshToken');
   window.location.search = '';
 }
 
@@ -25,6 +26,24 @@ app.ports.signOut.subscribe(function() {
   window.location.reload();
 });
 
+app.ports.refresh.subscribe(function() {
+  fetch('/refresh', { method: 'POST', credentials: 'same-origin' })
+    .then(function(resp) {
+      if (!resp.ok) {
+        throw new Error('could not refresh');
+      }
+      return resp.json();
+    })
+    .then(function(tokens) {
+      localStorage.setItem('idToken', tokens.token);
+      app.ports.storageGot.send(tokens.token);
+    })
+    .catch(function() {
+      localStorage.removeItem('idToken');
+      app.ports.storageGot.send(null);
+    });
+});
+
 app.ports.storageGet.subscribe(function(key) {
   const value = localStorage.getItem(key);
   app.ports.storageGot.send(value);
@@ -32,8 +32,10 @@ idToRoute (Id id) =
 type Stage
     = Thinking
     | Presenting
+    | Grouping
     | Voting
     | Discussing
+    | Done
 
 
 type alias Retro =
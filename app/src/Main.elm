@@ -54,6 +54,7 @@ type alias Model =
     , hasTest : Bool
     , hasGitHub : Bool
     , hasOffice365 : Bool
+    , oidcName : String
     }
 
 
@@ -72,6 +73,7 @@ init flags location =
                 , hasTest = False
                 , hasGitHub = False
                 , hasOffice365 = False
+                , oidcName = ""
                 }
     in
     initModel
@@ -198,8 +200,8 @@ socketUpdate msg model =
         Sock.Error { error } ->
             handleError error model
 
-        Sock.Hello { hasTest, hasGitHub, hasOffice365 } ->
-            { model | hasTest = hasTest, hasGitHub = hasGitHub, hasOffice365 = hasOffice365 } ! []
+        Sock.Hello { hasTest, hasGitHub, hasOffice365, oidcName } ->
+            { model | hasTest = hasTest, hasGitHub = hasGitHub, hasOffice365 = hasOffice365, oidcName = oidcName } ! []
 
         _ ->
             model ! []
@@ -211,6 +213,9 @@ handleError error model =
         "bad_auth" ->
             { model | token = Nothing, connected = True } ! []
 
+        "token_expired" ->
+            model ! [ Port.refresh () ]
+
         _ ->
             model ! []
 
@@ -68,7 +68,7 @@ update sender msg model =
                             else
                                 model ! []
 
-                        Retro.Voting ->
+                        Retro.Grouping ->
                             case maybeCardTo of
                                 Just cardTo ->
                                     if cardFrom /= cardTo then
@@ -127,12 +127,18 @@ parseStage s =
         "Presenting" ->
             Just Retro.Presenting
 
+        "Grouping" ->
+            Just Retro.Grouping
+
         "Voting" ->
             Just Retro.Voting
 
         "Discussing" ->
             Just Retro.Discussing
 
+        "Done" ->
+            Just Retro.Done
+
         _ ->
             Nothing
 
@@ -225,8 +231,14 @@ view username model =
                     Retro.Presenting ->
                         Views.Retro.Presenting.view username model
 
+                    Retro.Grouping ->
+                        Views.Retro.Voting.view model
+
                     Retro.Voting ->
                         Views.Retro.Voting.view model
+
+                    Retro.Done ->
+                        Views.Retro.Discussing.view model
                 ]
             ]
         , Views.Footer.view
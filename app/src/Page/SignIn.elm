@@ -6,8 +6,8 @@ import Html.Attributes as Attr
 import Views.Footer
 
 
-view : { a | hasTest : Bool, hasGitHub : Bool, hasOffice365 : Bool, connected : Bool } -> Html msg
-view { hasTest, hasGitHub, hasOffice365, connected } =
+view : { a | hasTest : Bool, hasGitHub : Bool, hasOffice365 : Bool, oidcName : String, connected : Bool } -> Html msg
+view { hasTest, hasGitHub, hasOffice365, oidcName, connected } =
     Html.div [ Attr.class "site-content" ]
         [ Html.section [ Attr.class "hero is-dark is-bold is-large fill-height" ]
             [ Html.div [ Attr.class "hero-body" ]
@@ -46,6 +46,16 @@ view { hasTest, hasGitHub, hasOffice365, connected } =
                                     ]
                               else
                                 Html.text ""
+                            , if oidcName /= "" then
+                                Html.p [ Attr.class "control" ]
+                                    [ Html.a
+                                        [ Attr.class "button is-primary is-outlined"
+                                        , Attr.href "/oauth/oidc/login"
+                                        ]
+                                        [ Html.text ("Sign-in with " ++ oidcName) ]
+                                    ]
+                              else
+                                Html.text ""
                             ]
                       else
                         Html.div []
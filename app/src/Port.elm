@@ -7,4 +7,7 @@ port storageGet : String -> Cmd msg
 port signOut : () -> Cmd msg
 
 
+port refresh : () -> Cmd msg
+
+
 port storageGot : (Maybe String -> msg) -> Sub msg
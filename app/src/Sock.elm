@@ -70,6 +70,7 @@ type alias HelloData =
     { hasGitHub : Bool
     , hasOffice365 : Bool
     , hasTest : Bool
+    , oidcName : String
     }
 
 
@@ -79,6 +80,7 @@ helloDecoder =
         |> Pipeline.required "hasGitHub" Decode.bool
         |> Pipeline.required "hasOffice365" Decode.bool
         |> Pipeline.required "hasTest" Decode.bool
+        |> Pipeline.optional "oidc" Decode.string ""
 
 
 type alias StageData =
@@ -34,8 +34,10 @@ view currentUser currentStage =
                     [ Html.ul []
                         [ tab currentStage Retro.Thinking
                         , tab currentStage Retro.Presenting
+                        , tab currentStage Retro.Grouping
                         , tab currentStage Retro.Voting
                         , tab currentStage Retro.Discussing
+                        , tab currentStage Retro.Done
                         ]
                     ]
                 ]
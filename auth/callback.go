@@ -2,4 +2,7 @@ package auth
 
 import "net/http"
 
-type AuthCallback func(w http.ResponseWriter, r *http.Request, allowed bool, user string)
+// AuthCallback is called when a user has signed in with a provider. Groups lists
+// the groups, such as GitHub organisations and teams, that the user was allowed
+// in by. Each group is prefixed with the provider's name and a colon.
+type AuthCallback func(w http.ResponseWriter, r *http.Request, allowed bool, user string, groups []string)
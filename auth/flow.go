@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Errors that a login can fail with. These are passed to the app as the "error"
+// parameter when redirecting back to it.
+var (
+	errDenied         = loginError("access_denied")
+	errInvalidState   = loginError("invalid_state")
+	errExchangeFailed = loginError("exchange_failed")
+	errUserLookup     = loginError("user_lookup_failed")
+	errProviderFailed = loginError("provider_unavailable")
+	errInvalidIDToken = loginError("invalid_id_token")
+	errLoginFailed    = loginError("login_failed")
+)
+
+// flowExpiry is how long a user has to sign in with the provider.
+const flowExpiry = 10 * time.Minute
+
+// cookieKey signs the cookies that hold the state of login flows. It is made
+// when retro starts, so any logins in progress on a restart must start again.
+var cookieKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+type loginError string
+
+func (e loginError) Error() string {
+	return string(e)
+}
+
+// flow protects the login for a provider against CSRF, by sending a random
+// state that must be returned, and against stolen codes, by using PKCE. Both
+// are kept in a signed cookie until the provider redirects back.
+type flow struct {
+	name string
+
+	// nonce sends a nonce that the provider must include in the ID token.
+	nonce bool
+}
+
+type flowState struct {
+	State    string    `json:"state"`
+	Verifier string    `json:"verifier"`
+	Nonce    string    `json:"nonce,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// login redirects to the provider so that the user can sign in.
+func (f flow) login(w http.ResponseWriter, r *http.Request, conf *oauth2.Config) {
+	state := flowState{
+		State:    randomString(),
+		Verifier: randomString(),
+		Expires:  time.Now().Add(flowExpiry),
+	}
+	if f.nonce {
+		state.Nonce = randomString()
+	}
+
+	value, err := signState(state)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     f.cookieName(),
+		Value:    value,
+		Path:     "/oauth/" + f.name + "/",
+		Expires:  state.Expires,
+		HttpOnly: true,
+		Secure:   secure(r, conf.RedirectURL),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	opts := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOnline,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if f.nonce {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", state.Nonce))
+	}
+
+	http.Redirect(w, r, conf.AuthCodeURL(state.State, opts...), http.StatusFound)
+}
+
+// exchange checks that the callback is for the login started by this browser,
+// and swaps the code it was given for a token. It returns the nonce that the ID
+// token must contain, if one was sent.
+func (f flow) exchange(w http.ResponseWriter, r *http.Request, conf *oauth2.Config) (*oauth2.Token, string, error) {
+	cookie, err := r.Cookie(f.cookieName())
+	if err != nil {
+		return nil, "", errInvalidState
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   f.cookieName(),
+		Path:   "/oauth/" + f.name + "/",
+		MaxAge: -1,
+	})
+
+	state, err := verifyState(cookie.Value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !hmac.Equal([]byte(state.State), []byte(r.FormValue("state"))) {
+		return nil, "", errInvalidState
+	}
+
+	if r.FormValue("error") != "" {
+		log.Println(f.name, "provider error:", r.FormValue("error"), r.FormValue("error_description"))
+		return nil, "", errDenied
+	}
+
+	tok, err := conf.Exchange(r.Context(), r.FormValue("code"),
+		oauth2.SetAuthURLParam("code_verifier", state.Verifier))
+	if err != nil {
+		log.Println(f.name, "exchange:", err)
+		return nil, "", errExchangeFailed
+	}
+
+	return tok, state.Nonce, nil
+}
+
+// secure is true when cookies should only be sent over HTTPS. Retro is often run
+// behind a proxy that handles TLS, so the scheme of the URL that the provider
+// redirects back to is used when it is configured. Otherwise the proxy is
+// trusted to say how the request was made, as a false header can only stop the
+// sender's own cookie from being sent.
+func secure(r *http.Request, redirectURL string) bool {
+	if u, err := url.Parse(redirectURL); err == nil && u.Scheme != "" {
+		return u.Scheme == "https"
+	}
+
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func (f flow) cookieName() string {
+	return "retro_oauth_" + f.name
+}
+
+// fail redirects back to the app with the reason that the login failed.
+func fail(w http.ResponseWriter, r *http.Request, err error) {
+	code, ok := err.(loginError)
+	if !ok {
+		log.Println(err)
+		code = errLoginFailed
+	}
+
+	http.Redirect(w, r, "/?error="+string(code), http.StatusFound)
+}
+
+func signState(state flowState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(stateMAC(payload)), nil
+}
+
+func verifyState(value string) (flowState, error) {
+	var state flowState
+
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return state, errInvalidState
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(mac, stateMAC(value[:i])) {
+		return state, errInvalidState
+	}
+
+	if err := decodeSegment(value[:i], &state); err != nil {
+		return state, errInvalidState
+	}
+	if time.Now().After(state.Expires) {
+		return state, errInvalidState
+	}
+
+	return state, nil
+}
+
+func stateMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, cookieKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
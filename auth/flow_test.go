@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestLoginCookieIsSecureForHTTPS(t *testing.T) {
+	for _, tc := range []struct {
+		redirectURL string
+		tls         bool
+		forwarded   string
+		secure      bool
+	}{
+		{redirectURL: "https://retro.example.com/oauth/test/callback", secure: true},
+		{redirectURL: "http://localhost:8080/oauth/test/callback"},
+		{redirectURL: "http://localhost:8080/oauth/test/callback", tls: true},
+		{redirectURL: "", tls: true, secure: true},
+		{redirectURL: "", forwarded: "https", secure: true},
+		{redirectURL: "", forwarded: "http"},
+		{redirectURL: ""},
+	} {
+		r := httptest.NewRequest("GET", "http://retro.example.com/oauth/test/login", nil)
+		if tc.tls {
+			r = httptest.NewRequest("GET", "https://retro.example.com/oauth/test/login", nil)
+		}
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-Proto", tc.forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		flow{name: "test"}.login(w, r, &oauth2.Config{
+			RedirectURL: tc.redirectURL,
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://provider.example.com/auth"},
+		})
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected a cookie, was %v", cookies)
+		}
+		if cookies[0].Secure != tc.secure {
+			t.Errorf("%q with TLS %v, forwarded %q: expected Secure to be %v", tc.redirectURL, tc.tls, tc.forwarded, tc.secure)
+		}
+	}
+}
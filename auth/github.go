@@ -1,16 +1,25 @@
 package auth
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 )
 
-func GitHub(authCallback AuthCallback, clientID, clientSecret, organisation string) (login, callback http.HandlerFunc) {
-	ctx := context.Background()
+// gitHubAPI is where requests to the GitHub API are made.
+var gitHubAPI = "https://api.github.com"
+
+// GitHub signs users in with GitHub. Users are allowed if they are a member of
+// any of the organisations, or of any of the teams, which are given as
+// "organisation/team-slug". The organisations and teams that matched are passed
+// to authCallback, prefixed with "github:".
+func GitHub(authCallback AuthCallback, clientID, clientSecret string, organisations, teams []string) (login, callback http.HandlerFunc) {
 	conf := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
@@ -21,77 +30,164 @@ func GitHub(authCallback AuthCallback, clientID, clientSecret, organisation stri
 		},
 	}
 
-	login = func(w http.ResponseWriter, r *http.Request) {
-		url := conf.AuthCodeURL("state", oauth2.AccessTypeOnline)
+	flow := flow{name: "github"}
 
-		http.Redirect(w, r, url, http.StatusFound)
+	login = func(w http.ResponseWriter, r *http.Request) {
+		flow.login(w, r, conf)
 	}
 
 	callback = func(w http.ResponseWriter, r *http.Request) {
-		code := r.FormValue("code")
-
-		tok, err := conf.Exchange(ctx, code)
+		tok, _, err := flow.exchange(w, r, conf)
 		if err != nil {
-			log.Println(err)
+			fail(w, r, err)
 			return
 		}
 
-		client := conf.Client(ctx, tok)
+		client := conf.Client(r.Context(), tok)
 
 		user, err := getUser(client)
 		if err != nil {
 			log.Println(err)
+			fail(w, r, errUserLookup)
 			return
 		}
 
-		inOrg, err := isInOrg(client, organisation)
+		groups, err := matchingGroups(client, organisations, teams)
 		if err != nil {
 			log.Println(err)
+			fail(w, r, errUserLookup)
 			return
 		}
 
-		authCallback(w, r, inOrg, user)
+		authCallback(w, r, len(groups) > 0, user, groups)
 	}
 
 	return login, callback
 }
 
 func getUser(client *http.Client) (string, error) {
-	resp, err := client.Get("https://api.github.com/user")
+	resp, err := client.Get(gitHubAPI + "/user")
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("github user responded %s", resp.Status)
+	}
+
 	var data struct {
 		Login string `json:"login"`
 	}
 	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return "", err
 	}
+	if data.Login == "" {
+		return "", errors.New("github user has no login")
+	}
 
 	return data.Login, nil
 }
 
-func isInOrg(client *http.Client, expectedOrg string) (bool, error) {
-	resp, err := client.Get("https://api.github.com/user/orgs")
-	if err != nil {
-		return false, err
+type gitHubOrg struct {
+	Login string `json:"login"`
+}
+
+type gitHubTeam struct {
+	Slug         string    `json:"slug"`
+	Organization gitHubOrg `json:"organization"`
+}
+
+// matchingGroups returns the organisations and teams, out of those given, that
+// the user is a member of. Names are returned as they were given, prefixed with
+// "github:" so that they can not be confused with groups from other providers.
+func matchingGroups(client *http.Client, organisations, teams []string) ([]string, error) {
+	var groups []string
+
+	if len(organisations) > 0 {
+		var orgs []gitHubOrg
+		err := getPages(client, gitHubAPI+"/user/orgs?per_page=100", func(body io.Reader) error {
+			var page []gitHubOrg
+			err := json.NewDecoder(body).Decode(&page)
+			orgs = append(orgs, page...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, expected := range organisations {
+			for _, org := range orgs {
+				if strings.EqualFold(org.Login, expected) {
+					groups = append(groups, "github:"+expected)
+					break
+				}
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	var data []struct {
-		Login string `json:"login"`
+	if len(teams) > 0 {
+		var userTeams []gitHubTeam
+		err := getPages(client, gitHubAPI+"/user/teams?per_page=100", func(body io.Reader) error {
+			var page []gitHubTeam
+			err := json.NewDecoder(body).Decode(&page)
+			userTeams = append(userTeams, page...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, expected := range teams {
+			for _, team := range userTeams {
+				if strings.EqualFold(team.Organization.Login+"/"+team.Slug, expected) {
+					groups = append(groups, "github:"+expected)
+					break
+				}
+			}
+		}
 	}
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return false, err
+
+	return groups, nil
+}
+
+// getPages calls page with the body of each page of a list from the GitHub API,
+// following the "next" link of each page.
+func getPages(client *http.Client, url string, page func(io.Reader) error) error {
+	for url != "" {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("github %s responded %s", url, resp.Status)
+		}
+
+		err = page(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		url = nextPage(resp.Header.Get("Link"))
 	}
 
-	for _, org := range data {
-		if org.Login == expectedOrg {
-			return true, nil
+	return nil
+}
+
+// nextPage finds the URL of the next page in a Link header, or returns an empty
+// string if there is not one.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		params := strings.Split(part, ";")
+		for _, param := range params[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(params[0]), "<>")
+			}
 		}
 	}
 
-	return false, nil
+	return ""
 }
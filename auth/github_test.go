@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves the user's organisations and teams from the GitHub API, each
+// split into pages of one item.
+func fakeGitHub(t *testing.T, orgs, teams []string) *httptest.Server {
+	var srv *httptest.Server
+
+	page := func(w http.ResponseWriter, r *http.Request, items []string) {
+		var n int
+		fmt.Sscan(r.FormValue("page"), &n)
+		if n+1 < len(items) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=%d>; rel="next", <%s%s?page=%d>; rel="last"`,
+				srv.URL, r.URL.Path, n+1, srv.URL, r.URL.Path, len(items)-1))
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=0>; rel="first"`, srv.URL, r.URL.Path))
+		}
+		if n < len(items) {
+			w.Write([]byte("[" + items[n] + "]"))
+		} else {
+			w.Write([]byte("[]"))
+		}
+	}
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user/orgs":
+			var items []string
+			for _, org := range orgs {
+				items = append(items, fmt.Sprintf(`{"login":%q}`, org))
+			}
+			page(w, r, items)
+
+		case "/user/teams":
+			var items []string
+			for _, team := range teams {
+				parts := strings.SplitN(team, "/", 2)
+				items = append(items, fmt.Sprintf(`{"slug":%q,"organization":{"login":%q}}`, parts[1], parts[0]))
+			}
+			page(w, r, items)
+
+		default:
+			t.Errorf("unexpected request to %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+
+	return srv
+}
+
+func TestMatchingGroups(t *testing.T) {
+	srv := fakeGitHub(t,
+		[]string{"other", "Acme", "devs"},
+		[]string{"other/ops", "Acme/devs", "acme/design"})
+	defer srv.Close()
+
+	defer func(api string) { gitHubAPI = api }(gitHubAPI)
+	gitHubAPI = srv.URL
+
+	for _, tc := range []struct {
+		name          string
+		organisations []string
+		teams         []string
+		groups        []string
+	}{
+		{name: "none"},
+		{
+			name:          "organisation on last page",
+			organisations: []string{"acme", "missing"},
+			groups:        []string{"github:acme"},
+		},
+		{
+			name:   "team on last page",
+			teams:  []string{"acme/design", "acme/ops"},
+			groups: []string{"github:acme/design"},
+		},
+		{
+			name:          "organisations and teams",
+			organisations: []string{"other", "devs"},
+			teams:         []string{"acme/devs", "other/devs"},
+			groups:        []string{"github:other", "github:devs", "github:acme/devs"},
+		},
+		{
+			name:          "team is not an organisation",
+			organisations: []string{"ops"},
+			teams:         []string{"devs", "acme"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := matchingGroups(srv.Client(), tc.organisations, tc.teams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(groups, " ") != strings.Join(tc.groups, " ") {
+				t.Fatalf("expected groups %v, was %v", tc.groups, groups)
+			}
+		})
+	}
+}
+
+func TestMatchingGroupsFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=1>; rel="next"`, r.Host, r.URL.Path))
+			w.Write([]byte(`[{"login":"other"}]`))
+			return
+		}
+		http.Error(w, "rate limited", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	defer func(api string) { gitHubAPI = api }(gitHubAPI)
+	gitHubAPI = srv.URL
+
+	if _, err := matchingGroups(srv.Client(), []string{"acme"}, nil); err == nil {
+		t.Fatal("expected a failed page to fail")
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	for link, expected := range map[string]string{
+		"": "",
+		`<https://api.github.com/user/orgs?page=2>; rel="next", <https://api.github.com/user/orgs?page=5>; rel="last"`:  "https://api.github.com/user/orgs?page=2",
+		`<https://api.github.com/user/orgs?page=1>; rel="prev", <https://api.github.com/user/orgs?page=2>; rel="next"`:  "https://api.github.com/user/orgs?page=2",
+		`<https://api.github.com/user/orgs?page=1>; rel="first", <https://api.github.com/user/orgs?page=1>; rel="prev"`: "",
+	} {
+		if next := nextPage(link); next != expected {
+			t.Errorf("expected next page of %q to be %q, was %q", link, expected, next)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package auth
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -11,7 +12,6 @@ import (
 )
 
 func Office365(authCallback AuthCallback, clientID, clientSecret, domain string) (login, callback http.HandlerFunc) {
-	ctx := context.Background()
 	conf := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
@@ -22,30 +22,29 @@ func Office365(authCallback AuthCallback, clientID, clientSecret, domain string)
 		},
 	}
 
-	login = func(w http.ResponseWriter, r *http.Request) {
-		url := conf.AuthCodeURL("state", oauth2.AccessTypeOnline)
+	flow := flow{name: "office365"}
 
-		http.Redirect(w, r, url, http.StatusFound)
+	login = func(w http.ResponseWriter, r *http.Request) {
+		flow.login(w, r, conf)
 	}
 
 	callback = func(w http.ResponseWriter, r *http.Request) {
-		code := r.FormValue("code")
-
-		tok, err := conf.Exchange(ctx, code)
+		tok, _, err := flow.exchange(w, r, conf)
 		if err != nil {
-			log.Println(err)
+			fail(w, r, err)
 			return
 		}
 
-		client := conf.Client(ctx, tok)
+		client := conf.Client(r.Context(), tok)
 
 		user, err := getOfficeUser(client)
 		if err != nil {
 			log.Println(err)
+			fail(w, r, errUserLookup)
 			return
 		}
 
-		authCallback(w, r, isInDomain(user, domain), user)
+		authCallback(w, r, isInDomain(user, domain), user, nil)
 	}
 
 	return login, callback
@@ -58,12 +57,19 @@ func getOfficeUser(client *http.Client) (string, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("office365 user responded %s", resp.Status)
+	}
+
 	var data struct {
 		Mail string `json:"mail"`
 	}
 	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return "", err
 	}
+	if data.Mail == "" {
+		return "", errors.New("office365 user has no mail")
+	}
 
 	return data.Mail, nil
 }
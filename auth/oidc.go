@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures a generic OpenID Connect provider.
+type OIDCConfig struct {
+	// DiscoveryURL is the provider's configuration document, usually the
+	// issuer followed by "/.well-known/openid-configuration".
+	DiscoveryURL string
+
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the callback URL registered with the provider.
+	RedirectURL string
+
+	// Scopes are requested in addition to "openid", "email" and "profile".
+	Scopes []string
+
+	// Domains, if given, lists the email domains that users must have.
+	Domains []string
+
+	// GroupsClaim names the claim listing the groups a user is in, and Groups,
+	// if given, lists the groups that users must be in at least one of. Either
+	// Domains or Groups must be given, or nobody can sign in.
+	GroupsClaim string
+	Groups      []string
+
+	// Client is used for requests to the provider. If nil http.DefaultClient is
+	// used.
+	Client *http.Client
+}
+
+// OIDC signs users in with an OpenID Connect provider. The provider's endpoints
+// and keys are discovered the first time they are needed. Users are identified
+// by the email in their ID token.
+func OIDC(authCallback AuthCallback, conf OIDCConfig) (login, callback http.HandlerFunc) {
+	client := conf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	provider := &oidcProvider{conf: conf, client: client}
+	flow := flow{name: "oidc", nonce: true}
+
+	login = func(w http.ResponseWriter, r *http.Request) {
+		oauthConf, err := provider.oauthConfig()
+		if err != nil {
+			log.Println(err)
+			fail(w, r, errProviderFailed)
+			return
+		}
+
+		flow.login(w, r, oauthConf)
+	}
+
+	callback = func(w http.ResponseWriter, r *http.Request) {
+		oauthConf, err := provider.oauthConfig()
+		if err != nil {
+			log.Println(err)
+			fail(w, r, errProviderFailed)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), oauth2.HTTPClient, provider.client)
+		tok, nonce, err := flow.exchange(w, r.WithContext(ctx), oauthConf)
+		if err != nil {
+			fail(w, r, err)
+			return
+		}
+
+		rawIDToken, ok := tok.Extra("id_token").(string)
+		if !ok {
+			log.Println("oidc: no id_token in token response")
+			fail(w, r, errInvalidIDToken)
+			return
+		}
+
+		claims, err := provider.verify(rawIDToken, nonce)
+		if err != nil {
+			log.Println(err)
+			fail(w, r, errInvalidIDToken)
+			return
+		}
+
+		user, groups, allowed := provider.allowed(claims)
+		authCallback(w, r, allowed, user, groups)
+	}
+
+	return login, callback
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	conf   OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func (p *oidcProvider) oauthConfig() (*oauth2.Config, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.conf.ClientID,
+		ClientSecret: p.conf.ClientSecret,
+		RedirectURL:  p.conf.RedirectURL,
+		Scopes:       append([]string{"openid", "email", "profile"}, p.conf.Scopes...),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}, nil
+}
+
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(p.conf.DiscoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if discovery.Issuer == "" || discovery.AuthorizationEndpoint == "" ||
+		discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the provider's signing key with the id given. The keys are
+// fetched again if the id is not known, as providers rotate their keys.
+func (p *oidcProvider) key(discovery *oidcDiscovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("oidc keys: %v", err)
+	}
+
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		p.keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oidc keys: no key with id %q", kid)
+	}
+
+	return key, nil
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce,
+// and returns its claims. Only tokens signed with RS256 are accepted.
+func (p *oidcProvider) verify(rawIDToken, nonce string) (map[string]interface{}, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed id token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("oidc: id token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oidc: id token signed with unsupported alg %q", header.Alg)
+	}
+
+	key, err := p.key(discovery, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("oidc: id token signature: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, errors.New("oidc: id token signature is not valid")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("oidc: id token claims: %v", err)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != discovery.Issuer {
+		return nil, fmt.Errorf("oidc: id token issued by %q", iss)
+	}
+	if !stringsClaim(claims, "aud", p.conf.ClientID) {
+		return nil, errors.New("oidc: id token is not for this client")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("oidc: id token has expired")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("oidc: id token has the wrong nonce")
+	}
+
+	return claims, nil
+}
+
+// allowed finds the user's email in the claims, and checks that it is in one of
+// the allowed domains and that the user is in one of the allowed groups. It
+// returns the allowed groups that the user is in, prefixed with "oidc:" so that
+// they can not be confused with groups from other providers. As users are identified by
+// their email it must have been verified by the provider, and as anyone can
+// usually sign up with a provider nobody is allowed unless domains or groups
+// are given.
+func (p *oidcProvider) allowed(claims map[string]interface{}) (string, []string, bool) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", nil, false
+	}
+
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return email, nil, false
+	}
+
+	if len(p.conf.Domains) == 0 && len(p.conf.Groups) == 0 {
+		return email, nil, false
+	}
+
+	if len(p.conf.Domains) > 0 {
+		inDomain := false
+		for _, domain := range p.conf.Domains {
+			if strings.HasSuffix(strings.ToLower(email), "@"+strings.ToLower(domain)) {
+				inDomain = true
+			}
+		}
+		if !inDomain {
+			return email, nil, false
+		}
+	}
+
+	var groups []string
+	for _, group := range p.conf.Groups {
+		if stringsClaim(claims, p.conf.GroupsClaim, group) {
+			groups = append(groups, "oidc:"+group)
+		}
+	}
+	if len(p.conf.Groups) > 0 && len(groups) == 0 {
+		return email, nil, false
+	}
+
+	return email, groups, true
+}
+
+func (p *oidcProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// stringsClaim checks whether the claim, which can be a string or a list of
+// strings, contains s.
+func stringsClaim(claims map[string]interface{}, name, s string) bool {
+	switch v := claims[name].(type) {
+	case string:
+		return v == s
+	case []interface{}:
+		for _, item := range v {
+			if item == s {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OpenID Connect provider that issues ID tokens with the claims
+// returned by claims.
+type fakeIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	signer *rsa.PrivateKey
+	claims func(nonce string) map[string]interface{}
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &fakeIssuer{t: t, key: key, signer: key}
+	mux := http.NewServeMux()
+	issuer.srv = httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.srv.URL,
+			"authorization_endpoint": issuer.srv.URL + "/auth",
+			"token_endpoint":         issuer.srv.URL + "/token",
+			"jwks_uri":               issuer.srv.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key",
+				"use": "sig",
+				"n":   encodeSegment(key.N.Bytes()),
+				"e":   encodeSegment(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		challenge, nonce := issuer.challenge, issuer.nonce
+		issuer.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if encodeSegment(verifier[:]) != challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.sign(issuer.claims(nonce)),
+		})
+	})
+
+	return issuer
+}
+
+func (issuer *fakeIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key"})
+	payload, _ := json.Marshal(claims)
+
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, issuer.signer, crypto.SHA256, hashed[:])
+	if err != nil {
+		issuer.t.Fatal(err)
+	}
+
+	return signed + "." + encodeSegment(signature)
+}
+
+// validClaims returns claims for a token that should be accepted.
+func (issuer *fakeIssuer) validClaims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            issuer.srv.URL,
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         []string{"engineering", "design"},
+	}
+}
+
+type oidcResult struct {
+	called   bool
+	allowed  bool
+	user     string
+	groups   []string
+	location string
+}
+
+// signIn goes through the login flow, returning what authCallback was called
+// with, or where the user was redirected if it was not called.
+func (issuer *fakeIssuer) signIn(conf OIDCConfig) oidcResult {
+	conf.DiscoveryURL = issuer.srv.URL + "/.well-known/openid-configuration"
+	conf.ClientID = "client"
+
+	var result oidcResult
+	login, callback := OIDC(func(w http.ResponseWriter, r *http.Request, allowed bool, user string, groups []string) {
+		result = oidcResult{called: true, allowed: allowed, user: user, groups: groups}
+	}, conf)
+
+	w := httptest.NewRecorder()
+	login(w, httptest.NewRequest("GET", "/oauth/oidc/login", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		issuer.t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), issuer.srv.URL+"/auth?") {
+		result.location = location.String()
+		return result
+	}
+
+	query := location.Query()
+	issuer.mu.Lock()
+	issuer.challenge, issuer.nonce = query.Get("code_challenge"), query.Get("nonce")
+	issuer.mu.Unlock()
+
+	r := httptest.NewRequest("GET", "/oauth/oidc/callback?code=code&state="+url.QueryEscape(query.Get("state")), nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	w = httptest.NewRecorder()
+	callback(w, r)
+	if !result.called {
+		result.location = w.Header().Get("Location")
+	}
+
+	return result
+}
+
+func TestOIDC(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	defer issuer.srv.Close()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withClaim := func(name string, value interface{}) func(string) map[string]interface{} {
+		return func(nonce string) map[string]interface{} {
+			claims := issuer.validClaims(nonce)
+			claims[name] = value
+			return claims
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		claims   func(string) map[string]interface{}
+		signer   *rsa.PrivateKey
+		location string
+	}{
+		{name: "valid", claims: issuer.validClaims},
+		{name: "bad signature", claims: issuer.validClaims, signer: otherKey, location: "/?error=invalid_id_token"},
+		{name: "bad aud", claims: withClaim("aud", "other"), location: "/?error=invalid_id_token"},
+		{name: "bad iss", claims: withClaim("iss", "http://other.example.com"), location: "/?error=invalid_id_token"},
+		{name: "expired", claims: withClaim("exp", time.Now().Add(-time.Minute).Unix()), location: "/?error=invalid_id_token"},
+		{name: "bad nonce", claims: withClaim("nonce", "other"), location: "/?error=invalid_id_token"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer.claims = tc.claims
+			issuer.signer = issuer.key
+			if tc.signer != nil {
+				issuer.signer = tc.signer
+			}
+
+			result := issuer.signIn(OIDCConfig{Domains: []string{"example.com"}})
+
+			if tc.location != "" {
+				if result.called {
+					t.Fatal("expected authCallback not to be called")
+				}
+				if result.location != tc.location {
+					t.Fatalf("expected redirect to %s, was %s", tc.location, result.location)
+				}
+				return
+			}
+
+			if !result.called || !result.allowed || result.user != "alice@example.com" {
+				t.Fatalf("expected alice@example.com to be allowed, was %+v", result)
+			}
+		})
+	}
+}
+
+func TestOIDCAllowed(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	defer issuer.srv.Close()
+
+	withClaims := func(claims map[string]interface{}) func(string) map[string]interface{} {
+		return func(nonce string) map[string]interface{} {
+			valid := issuer.validClaims(nonce)
+			for name, value := range claims {
+				if value == nil {
+					delete(valid, name)
+				} else {
+					valid[name] = value
+				}
+			}
+			return valid
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		conf    OIDCConfig
+		claims  map[string]interface{}
+		allowed bool
+		groups  []string
+	}{
+		{name: "no domains or groups"},
+		{name: "unverified", conf: OIDCConfig{Domains: []string{"example.com"}}, claims: map[string]interface{}{"email_verified": false}},
+		{name: "verification unknown", conf: OIDCConfig{GroupsClaim: "groups", Groups: []string{"design"}}, claims: map[string]interface{}{"email_verified": nil}},
+		{name: "in domain", conf: OIDCConfig{Domains: []string{"Example.com"}}, allowed: true},
+		{name: "not in domain", conf: OIDCConfig{Domains: []string{"example.org"}}},
+		{name: "in domain unverified", conf: OIDCConfig{Domains: []string{"example.com"}}, claims: map[string]interface{}{"email_verified": nil}},
+		{
+			name:    "in group",
+			conf:    OIDCConfig{GroupsClaim: "groups", Groups: []string{"design", "ops", "engineering"}},
+			allowed: true,
+			groups:  []string{"oidc:design", "oidc:engineering"},
+		},
+		{name: "not in group", conf: OIDCConfig{GroupsClaim: "groups", Groups: []string{"ops"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer.claims = withClaims(tc.claims)
+
+			result := issuer.signIn(tc.conf)
+			if !result.called {
+				t.Fatalf("expected authCallback to be called, redirected to %s", result.location)
+			}
+			if result.allowed != tc.allowed {
+				t.Fatalf("expected allowed to be %v", tc.allowed)
+			}
+			if strings.Join(result.groups, " ") != strings.Join(tc.groups, " ") {
+				t.Fatalf("expected groups %v, was %v", tc.groups, result.groups)
+			}
+		})
+	}
+}
+
+func TestOIDCUsesClient(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	defer issuer.srv.Close()
+	issuer.claims = issuer.validClaims
+
+	var mu sync.Mutex
+	var paths []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	if result := issuer.signIn(OIDCConfig{Client: client, Domains: []string{"example.com"}}); !result.allowed {
+		t.Fatalf("expected to be allowed, was %+v", result)
+	}
+
+	expected := []string{"/.well-known/openid-configuration", "/token", "/jwks"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected client to request %v, requested %v", expected, paths)
+	}
+}
+
+func TestOIDCDiscoveryFails(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	login, _ := OIDC(func(http.ResponseWriter, *http.Request, bool, string, []string) {
+		t.Fatal("expected authCallback not to be called")
+	}, OIDCConfig{DiscoveryURL: srv.URL + "/.well-known/openid-configuration"})
+
+	w := httptest.NewRecorder()
+	login(w, httptest.NewRequest("GET", "/oauth/oidc/login", nil))
+	if location := w.Header().Get("Location"); location != "/?error=provider_unavailable" {
+		t.Fatalf("expected redirect to /?error=provider_unavailable, was %s", location)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -8,7 +8,7 @@ func Test(authCallback AuthCallback) (login, callback http.HandlerFunc) {
 	}
 
 	callback = func(w http.ResponseWriter, r *http.Request) {
-		authCallback(w, r, true, "test@example.com")
+		authCallback(w, r, true, "test@example.com", nil)
 	}
 
 	return login, callback
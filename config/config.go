@@ -1,15 +1,28 @@
 package config
 
-import "github.com/BurntSushi/toml"
+import (
+	"errors"
+
+	"github.com/BurntSushi/toml"
+)
 
 type Config struct {
 	GitHub    *GitHub    `toml:"github"`
 	Office365 *Office365 `toml:"office365"`
+	OIDC      *OIDC      `toml:"oidc"`
+	Templates []Template `toml:"template"`
 }
 
+// GitHub configures sign-in with GitHub. Users must be a member of one of the
+// Organisations, or one of the Teams given as "organisation/team-slug".
 type GitHub struct {
-	ClientID     string `toml:"clientID"`
-	ClientSecret string `toml:"clientSecret"`
+	ClientID      string   `toml:"clientID"`
+	ClientSecret  string   `toml:"clientSecret"`
+	Organisations []string `toml:"organisations"`
+	Teams         []string `toml:"teams"`
+
+	// Organisation is the single organisation that could be given before
+	// Organisations, it is added to Organisations when read.
 	Organisation string `toml:"organisation"`
 }
 
@@ -19,8 +32,65 @@ type Office365 struct {
 	Domain       string `toml:"domain"`
 }
 
+// OIDC configures sign-in with an OpenID Connect provider. Users must have an
+// email in one of Domains, and be in one of Groups, when they are given. At
+// least one of Domains or Groups must be given.
+type OIDC struct {
+	// Name is shown on the sign-in button.
+	Name         string   `toml:"name"`
+	DiscoveryURL string   `toml:"discoveryURL"`
+	ClientID     string   `toml:"clientID"`
+	ClientSecret string   `toml:"clientSecret"`
+	RedirectURL  string   `toml:"redirectURL"`
+	Scopes       []string `toml:"scopes"`
+	Domains      []string `toml:"domains"`
+	GroupsClaim  string   `toml:"groupsClaim"`
+	Groups       []string `toml:"groups"`
+}
+
+// Template is a named set of columns that a retro can be created with.
+type Template struct {
+	Id      string   `toml:"id"`
+	Name    string   `toml:"name"`
+	Columns []string `toml:"columns"`
+}
+
+// DefaultTemplate is used when creating a retro without choosing a template. It
+// can be replaced by defining a template with the same id.
+var DefaultTemplate = Template{
+	Id:      "default",
+	Name:    "Start, More, Keep, Less, Stop",
+	Columns: []string{"Start", "More", "Keep", "Less", "Stop"},
+}
+
 func Read(path string) (Config, error) {
 	var conf Config
-	_, err := toml.DecodeFile(path, &conf)
-	return conf, err
+	if _, err := toml.DecodeFile(path, &conf); err != nil {
+		return conf, err
+	}
+
+	if conf.GitHub != nil && conf.GitHub.Organisation != "" {
+		conf.GitHub.Organisations = append(conf.GitHub.Organisations, conf.GitHub.Organisation)
+	}
+
+	if conf.OIDC != nil {
+		if conf.OIDC.Name == "" {
+			conf.OIDC.Name = "OpenID Connect"
+		}
+		if conf.OIDC.GroupsClaim == "" {
+			conf.OIDC.GroupsClaim = "groups"
+		}
+		if len(conf.OIDC.Domains) == 0 && len(conf.OIDC.Groups) == 0 {
+			return conf, errors.New("oidc: domains or groups must be given")
+		}
+	}
+
+	for _, template := range conf.Templates {
+		if template.Id == DefaultTemplate.Id {
+			return conf, nil
+		}
+	}
+
+	conf.Templates = append([]Template{DefaultTemplate}, conf.Templates...)
+	return conf, nil
 }
@@ -0,0 +1,131 @@
+package database
+
+import "time"
+
+const (
+	ActionOpen = "open"
+	ActionDone = "done"
+)
+
+type Action struct {
+	Id     string
+	Retro  string
+	Card   string
+	Text   string
+	Owner  string
+	Due    *time.Time
+	Status string
+}
+
+// AddAction adds a new action that was decided on in action.Retro.
+func (d *Database) AddAction(action Action) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO actions(Id, Retro, Card, Text, Owner, Due, Status) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		action.Id,
+		action.Retro,
+		action.Card,
+		action.Text,
+		action.Owner,
+		action.Due,
+		action.Status)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO retro_actions(Retro, Action) VALUES (?, ?)",
+		action.Retro,
+		action.Id)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) AssignAction(id, owner string, due *time.Time) error {
+	_, err := d.db.Exec("UPDATE actions SET Owner=?, Due=? WHERE Id=?",
+		owner,
+		due,
+		id)
+
+	return err
+}
+
+func (d *Database) SetActionStatus(id, status string) error {
+	_, err := d.db.Exec("UPDATE actions SET Status=? WHERE Id=?",
+		status,
+		id)
+
+	return err
+}
+
+// CarryActions makes the unfinished actions that are listed in retroFrom also
+// listed in retroTo.
+func (d *Database) CarryActions(retroFrom, retroTo string) error {
+	_, err := d.db.Exec(`
+    INSERT INTO retro_actions(Retro, Action)
+    SELECT CAST(? AS TEXT), actions.Id
+    FROM actions
+    INNER JOIN retro_actions ON actions.Id = retro_actions.Action
+    WHERE retro_actions.Retro = ? AND actions.Status != ?`,
+		retroTo,
+		retroFrom,
+		ActionDone)
+
+	return err
+}
+
+// IsActionInRetro checks whether the action is listed in the retro, either
+// because it was added there or it was carried over.
+func (d *Database) IsActionInRetro(id, retroId string) (bool, error) {
+	row := d.db.QueryRow("SELECT COUNT(*) FROM retro_actions WHERE Action=? AND Retro=?",
+		id,
+		retroId)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count > 0, err
+}
+
+func (d *Database) GetAction(id string) (Action, error) {
+	row := d.db.QueryRow("SELECT Id, Retro, Card, Text, Owner, Due, Status FROM actions WHERE Id=?",
+		id)
+
+	var action Action
+	err := row.Scan(&action.Id, &action.Retro, &action.Card, &action.Text, &action.Owner, &action.Due, &action.Status)
+
+	return action, err
+}
+
+// GetActions lists the actions added in, or carried over to, the retro.
+func (d *Database) GetActions(retroId string) (actions []Action, err error) {
+	rows, err := d.db.Query(`
+    SELECT actions.Id, actions.Retro, actions.Card, actions.Text, actions.Owner, actions.Due, actions.Status
+    FROM actions
+    INNER JOIN retro_actions ON actions.Id = retro_actions.Action
+    WHERE retro_actions.Retro = ?`,
+		retroId)
+	if err != nil {
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action Action
+		if err = rows.Scan(&action.Id, &action.Retro, &action.Card, &action.Text, &action.Owner, &action.Due, &action.Status); err != nil {
+			return actions, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
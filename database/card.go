@@ -9,7 +9,7 @@ type Card struct {
 }
 
 func (d *Database) AddCard(card Card) error {
-	_, err := d.db.Exec("INSERT INTO cards(Id, Column, Revealed) VALUES (?, ?, ?)",
+	_, err := d.db.Exec("INSERT INTO cards(Id, \"Column\", Revealed) VALUES (?, ?, ?)",
 		card.Id,
 		card.Column,
 		card.Revealed)
@@ -18,7 +18,7 @@ func (d *Database) AddCard(card Card) error {
 }
 
 func (d *Database) MoveCard(id, columnId string) error {
-	_, err := d.db.Exec("UPDATE cards SET Column=? WHERE Id=?",
+	_, err := d.db.Exec("UPDATE cards SET \"Column\"=? WHERE Id=?",
 		columnId,
 		id)
 
@@ -26,17 +26,31 @@ func (d *Database) MoveCard(id, columnId string) error {
 }
 
 func (d *Database) RevealCard(id string) error {
-	_, err := d.db.Exec("UPDATE cards SET Revealed=1 WHERE Id=?",
+	_, err := d.db.Exec("UPDATE cards SET Revealed=? WHERE Id=?",
+		true,
 		id)
 
 	return err
 }
 
 func (d *Database) DeleteCard(id string) error {
-	_, err := d.db.Exec("DELETE FROM cards WHERE Id=?",
-		id)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
 
-	return err
+	for _, query := range []string{
+		"DELETE FROM votes WHERE Card=?",
+		"DELETE FROM contents WHERE Card=?",
+		"DELETE FROM cards WHERE Id=?",
+	} {
+		if _, err = tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (d *Database) GroupCards(cardFrom, cardTo string) error {
@@ -74,17 +88,94 @@ func (d *Database) GroupCards(cardFrom, cardTo string) error {
 	return tx.Commit()
 }
 
+// An Ungroup moves some of the contents of a card to a new card.
+type Ungroup struct {
+	CardFrom string
+	CardTo   Card
+	Contents []string
+
+	// Votes lists the votes that move with the contents. If ResetVotes is true
+	// every vote on CardFrom is removed instead.
+	Votes      []int64
+	ResetVotes bool
+}
+
+func (d *Database) UngroupCard(ungroup Ungroup) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(query, args...)
+	}
+
+	exec("INSERT INTO cards(Id, \"Column\", Revealed) VALUES (?, ?, ?)",
+		ungroup.CardTo.Id,
+		ungroup.CardTo.Column,
+		ungroup.CardTo.Revealed)
+
+	for _, contentId := range ungroup.Contents {
+		exec("UPDATE contents SET Card=? WHERE Id=? AND Card=?",
+			ungroup.CardTo.Id,
+			contentId,
+			ungroup.CardFrom)
+	}
+
+	if ungroup.ResetVotes {
+		exec("DELETE FROM votes WHERE Card=?",
+			ungroup.CardFrom)
+	} else {
+		for _, voteId := range ungroup.Votes {
+			exec("UPDATE votes SET Card=? WHERE Id=? AND Card=?",
+				ungroup.CardTo.Id,
+				voteId,
+				ungroup.CardFrom)
+		}
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) GetCard(id string) (Card, error) {
+	row := d.db.QueryRow("SELECT Id, \"Column\", Revealed FROM cards WHERE Id=?",
+		id)
+
+	var card Card
+	err := row.Scan(&card.Id, &card.Column, &card.Revealed)
+
+	return card, err
+}
+
+func (d *Database) CountCards(columnId string) (int, error) {
+	row := d.db.QueryRow("SELECT COUNT(*) FROM cards WHERE \"Column\"=?",
+		columnId)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count, err
+}
+
 func (d *Database) GetCards(username, columnId string) (cards []Card, err error) {
 	rows, err := d.db.Query(`
     SELECT cards.Id,
-           cards.Column,
+           cards."Column",
            cards.Revealed,
            SUM(CASE WHEN votes.Username = ? THEN 1 ELSE 0 END),
            COUNT(votes.Id)
     FROM cards
     LEFT JOIN votes ON cards.Id = votes.Card
-    WHERE cards.Column = ?
-    GROUP BY cards.Id, cards.Column, cards.Revealed`,
+    WHERE cards."Column" = ?
+    GROUP BY cards.Id, cards."Column", cards.Revealed`,
 		username, columnId)
 	if err != nil {
 		return cards, err
@@ -1,5 +1,24 @@
 package database
 
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrColumnMismatch is returned when reordering columns with a list that
+	// does not contain exactly the columns of the retro.
+	ErrColumnMismatch = errors.New("columns do not match retro")
+
+	// ErrColumnNotEmpty is returned when deleting a column that has cards which
+	// were not listed to be deleted.
+	ErrColumnNotEmpty = errors.New("column is not empty")
+
+	// ErrColumnDeleted is returned when undoing a change would put a card back
+	// in a column that has been deleted.
+	ErrColumnDeleted = errors.New("column has been deleted")
+)
+
 type Column struct {
 	Id    string
 	Retro string
@@ -18,7 +37,7 @@ func (d *Database) AddColumn(column Column) error {
 }
 
 func (d *Database) GetColumn(id string) (Column, error) {
-	row := d.db.QueryRow("SELECT Id, Retro, Name, Order FROM columns WHERE Id=?",
+	row := d.db.QueryRow("SELECT Id, Retro, Name, \"Order\" FROM columns WHERE Id=?",
 		id)
 
 	var column Column
@@ -45,3 +64,103 @@ func (d *Database) GetColumns(retroId string) (columns []Column, err error) {
 
 	return columns, rows.Err()
 }
+
+func (d *Database) RenameColumn(id, name string) error {
+	_, err := d.db.Exec("UPDATE columns SET Name=? WHERE Id=?",
+		name,
+		id)
+
+	return err
+}
+
+// ReorderColumns sets the order of the columns in a retro to match the order of
+// columnIds. Every column in the retro must be given.
+func (d *Database) ReorderColumns(retroId string, columnIds []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM columns WHERE Retro=?", retroId).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count != len(columnIds) {
+		tx.Rollback()
+		return ErrColumnMismatch
+	}
+
+	for i, columnId := range columnIds {
+		result, err := tx.Exec("UPDATE columns SET \"Order\"=? WHERE Id=? AND Retro=?",
+			i,
+			columnId,
+			retroId)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n != 1 {
+			tx.Rollback()
+			if err != nil {
+				return err
+			}
+			return ErrColumnMismatch
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteColumn removes a column. If cardsTo is given any cards in the column are
+// moved to that column, otherwise the cards listed are deleted along with their
+// contents and votes. If the column would still have cards, such as one added
+// after the list was made, ErrColumnNotEmpty is returned and nothing is changed.
+func (d *Database) DeleteColumn(id, cardsTo string, cardIds []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(query, args...)
+	}
+
+	if cardsTo != "" {
+		exec("UPDATE cards SET \"Column\"=? WHERE \"Column\"=?", cardsTo, id)
+	} else {
+		for _, cardId := range cardIds {
+			exec("DELETE FROM votes WHERE Card IN (SELECT Id FROM cards WHERE Id=? AND \"Column\"=?)", cardId, id)
+			exec("DELETE FROM contents WHERE Card IN (SELECT Id FROM cards WHERE Id=? AND \"Column\"=?)", cardId, id)
+			exec("DELETE FROM cards WHERE Id=? AND \"Column\"=?", cardId, id)
+		}
+	}
+
+	var result sql.Result
+	if err == nil {
+		result, err = tx.Exec("DELETE FROM columns WHERE Id=? AND NOT EXISTS (SELECT 1 FROM cards WHERE \"Column\"=?)",
+			id,
+			id)
+	}
+	if err == nil {
+		var n int64
+		if n, err = result.RowsAffected(); err == nil && n == 0 {
+			var cards int
+			if err = tx.QueryRow("SELECT COUNT(*) FROM cards WHERE \"Column\"=?", id).Scan(&cards); err == nil && cards > 0 {
+				err = ErrColumnNotEmpty
+			}
+		}
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -12,7 +12,7 @@ func (d *Database) AddContent(content Content) error {
 		content.Id,
 		content.Card,
 		content.Text,
-		content.Author)
+		nullable(content.Author))
 
 	return err
 }
@@ -26,7 +26,7 @@ func (d *Database) UpdateContent(id string, text string) error {
 }
 
 func (d *Database) GetContent(id string) (Content, error) {
-	row := d.db.QueryRow("SELECT Id, Card, Text, Author FROM contents WHERE Id=?",
+	row := d.db.QueryRow("SELECT Id, Card, Text, COALESCE(Author, '') FROM contents WHERE Id=?",
 		id)
 
 	var content Content
@@ -36,7 +36,7 @@ func (d *Database) GetContent(id string) (Content, error) {
 }
 
 func (d *Database) GetContents(cardId string) (contents []Content, err error) {
-	rows, err := d.db.Query("SELECT Id, Card, Text, Author FROM contents WHERE Card=?",
+	rows, err := d.db.Query("SELECT Id, Card, Text, COALESCE(Author, '') FROM contents WHERE Card=?",
 		cardId)
 	if err != nil {
 		return contents, err
@@ -1,101 +1,79 @@
 package database
 
 import (
-	_ "github.com/mxk/go-sqlite/sqlite3"
-
 	"database/sql"
+	"strings"
 )
 
 type Database struct {
-	db *sql.DB
+	db      *conn
+	dialect dialect
 }
 
-func Open(path string) (*Database, error) {
-	sqlite, err := sql.Open("sqlite3", path)
+// Open connects to the database at url. If url has the scheme "postgres" or
+// "postgresql" it is used to connect to Postgres, otherwise it is treated as
+// the path to a SQLite database.
+func Open(url string) (*Database, error) {
+	dialect := sqlite
+	if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		dialect = postgres
+	}
+
+	sqlDB, err := sql.Open(dialect.driver, url)
 	if err != nil {
 		return nil, err
 	}
 
-	db := &Database{sqlite}
+	db := &Database{
+		db:      &conn{db: sqlDB, rebind: dialect.rebind},
+		dialect: dialect,
+	}
 
-	return db, db.setup()
+	return db, db.migrate()
 }
 
 func (d *Database) Reset() error {
-	_, err := d.db.Exec(`
-    DROP TABLE users;
-    DROP TABLE retros;
-    DROP TABLE participants;
-    DROP TABLE columns;
-    DROP TABLE cards;
-    DROP TABLE contents;
-    DROP TABLE votes;
-`)
+	_, err := d.db.Exec(d.dialect.dropTables(tables))
 	if err != nil {
 		return err
 	}
 
-	return d.setup()
+	return d.migrate()
 }
 
-func (d *Database) setup() error {
-	_, err := d.db.Exec(`
-    CREATE TABLE IF NOT EXISTS users (
-      Username  TEXT PRIMARY KEY,
-      Secret    TEXT
-    );
-
-    CREATE TABLE IF NOT EXISTS retros (
-      Id        TEXT PRIMARY KEY,
-      Name      TEXT,
-      Stage     TEXT,
-      CreatedAt DATETIME
-    );
-
-    CREATE TABLE IF NOT EXISTS participants (
-      Retro     TEXT,
-      Username  TEXT,
-      PRIMARY KEY(Username, Retro),
-      FOREIGN KEY(Retro) REFERENCES retros(Id),
-      FOREIGN KEY(Username) REFERENCES users(Username)
-    );
-
-    CREATE TABLE IF NOT EXISTS columns (
-      Id        TEXT PRIMARY KEY,
-      Retro     TEXT,
-      Name      TEXT,
-      "Order"   INTEGER,
-      FOREIGN KEY(Retro) REFERENCES retros(Id)
-    );
-
-    CREATE TABLE IF NOT EXISTS cards (
-      Id        TEXT PRIMARY KEY,
-      Column    TEXT,
-      Revealed  BOOLEAN,
-      FOREIGN KEY(Column) REFERENCES columns(Id)
-    );
-
-    CREATE TABLE IF NOT EXISTS contents (
-      Id        TEXT PRIMARY KEY,
-      Card      TEXT,
-      Text      TEXT,
-      Author    TEXT,
-      FOREIGN KEY(Card) REFERENCES cards(Id),
-      FOREIGN KEY(Author) REFERENCES users(Username)
-    );
-
-    CREATE TABLE IF NOT EXISTS votes (
-      Id        INTEGER PRIMARY KEY,
-      Username  TEXT,
-      Card      TEXT,
-      FOREIGN KEY(Username) REFERENCES users(Username),
-      FOREIGN KEY(Card) REFERENCES cards(Id)
-    );
-  `)
-
-	return err
+// tables lists every table, so that they can be dropped in order.
+var tables = []string{
+	"sessions",
+	"retro_groups",
+	"memberships",
+	"timers",
+	"shares",
+	"revisions",
+	"vote_budgets",
+	"retro_actions",
+	"actions",
+	"template_columns",
+	"templates",
+	"votes",
+	"contents",
+	"cards",
+	"columns",
+	"participants",
+	"retros",
+	"users",
+	"schema_version",
 }
 
 func (d *Database) Close() error {
 	return d.db.Close()
 }
+
+// nullable stores an empty string as NULL. Authors and voters reference users,
+// so are NULL when a card or vote has no user, as is the case for imported retros.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
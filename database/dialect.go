@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mxk/go-sqlite/sqlite3"
+)
+
+// A dialect contains the parts of SQL that differ between the databases that
+// are supported. Queries are written for SQLite, using "?" for parameters, and
+// rebind converts them for the database.
+type dialect struct {
+	driver     string
+	migrations []string
+
+	rebind func(query string) string
+
+	// insertOrIgnore inserts a row unless it would conflict with an existing
+	// row.
+	insertOrIgnore func(table string, columns ...string) string
+
+	// upsert inserts a row, or updates the existing row with the same keys.
+	upsert func(table string, keys []string, columns ...string) string
+
+	dropTables func(tables []string) string
+}
+
+var sqlite = dialect{
+	driver:     "sqlite3",
+	migrations: sqliteMigrations,
+	rebind: func(query string) string {
+		return query
+	},
+	insertOrIgnore: func(table string, columns ...string) string {
+		return "INSERT OR IGNORE INTO " + table + insertColumns(columns)
+	},
+	upsert: func(table string, keys []string, columns ...string) string {
+		return "INSERT OR REPLACE INTO " + table + insertColumns(append(keys, columns...))
+	},
+	dropTables: func(tables []string) string {
+		var query string
+		for _, table := range tables {
+			query += "DROP TABLE " + table + ";\n"
+		}
+		return query
+	},
+}
+
+var postgres = dialect{
+	driver:     "postgres",
+	migrations: postgresMigrations,
+	rebind: func(query string) string {
+		var b strings.Builder
+		n := 0
+		for _, r := range query {
+			if r == '?' {
+				n++
+				b.WriteString("$" + strconv.Itoa(n))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	},
+	insertOrIgnore: func(table string, columns ...string) string {
+		return "INSERT INTO " + table + insertColumns(columns) + " ON CONFLICT DO NOTHING"
+	},
+	upsert: func(table string, keys []string, columns ...string) string {
+		var updates []string
+		for _, column := range columns {
+			updates = append(updates, column+"=excluded."+column)
+		}
+
+		return "INSERT INTO " + table + insertColumns(append(keys, columns...)) +
+			" ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	},
+	dropTables: func(tables []string) string {
+		return "DROP TABLE " + strings.Join(tables, ", ") + " CASCADE"
+	},
+}
+
+func insertColumns(columns []string) string {
+	return "(" + strings.Join(columns, ", ") + ") VALUES (?" + strings.Repeat(", ?", len(columns)-1) + ")"
+}
+
+// conn wraps a database connection so that queries are rebound for the dialect
+// being used.
+type conn struct {
+	db     *sql.DB
+	rebind func(string) string
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.Exec(c.rebind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.Query(c.rebind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRow(c.rebind(query), args...)
+}
+
+func (c *conn) Begin() (*tx, error) {
+	sqlTx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx{tx: sqlTx, rebind: c.rebind}, nil
+}
+
+func (c *conn) Close() error {
+	return c.db.Close()
+}
+
+type tx struct {
+	tx     *sql.Tx
+	rebind func(string) string
+}
+
+func (t *tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.Exec(t.rebind(query), args...)
+}
+
+func (t *tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.Query(t.rebind(query), args...)
+}
+
+func (t *tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRow(t.rebind(query), args...)
+}
+
+func (t *tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// RetroExport is a complete copy of a retro, it is used to export retros to
+// other formats.
+type RetroExport struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	Stage        string    `json:"stage"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Anonymous    bool      `json:"anonymous"`
+	Participants []string  `json:"participants"`
+
+	// Roles gives the role of each participant that is not a plain participant.
+	Roles map[string]string `json:"roles"`
+
+	// Facilitator is read from exports made before roles were added, and is the
+	// owner of the retro.
+	Facilitator string `json:"facilitator,omitempty"`
+
+	VoteBudget VoteBudgetExport `json:"voteBudget"`
+	Columns    []ColumnExport   `json:"columns"`
+	Actions    []ActionExport   `json:"actions"`
+}
+
+type VoteBudgetExport struct {
+	PerUser int `json:"perUser"`
+	PerCard int `json:"perCard"`
+}
+
+type ColumnExport struct {
+	Id    string       `json:"id"`
+	Name  string       `json:"name"`
+	Order int          `json:"order"`
+	Cards []CardExport `json:"cards"`
+}
+
+type CardExport struct {
+	Id         string          `json:"id"`
+	Revealed   bool            `json:"revealed"`
+	TotalVotes int             `json:"totalVotes"`
+	Votes      map[string]int  `json:"votes"`
+	Contents   []ContentExport `json:"contents"`
+}
+
+type ContentExport struct {
+	Id     string `json:"id"`
+	Text   string `json:"text"`
+	Author string `json:"author"`
+}
+
+type ActionExport struct {
+	Id     string     `json:"id"`
+	Card   string     `json:"card"`
+	Text   string     `json:"text"`
+	Owner  string     `json:"owner"`
+	Due    *time.Time `json:"due"`
+	Status string     `json:"status"`
+}
+
+// ExportRetro reads everything about a retro. Cards are ordered by the number of
+// votes they have.
+func (d *Database) ExportRetro(id string) (RetroExport, error) {
+	retro, err := d.GetRetro(id)
+	if err != nil {
+		return RetroExport{}, err
+	}
+
+	export := RetroExport{
+		Id:        retro.Id,
+		Name:      retro.Name,
+		Stage:     retro.Stage,
+		CreatedAt: retro.CreatedAt,
+		Anonymous: retro.Anonymous,
+	}
+
+	if export.Participants, err = d.GetParticipants(id); err != nil {
+		return export, err
+	}
+
+	roles, err := d.GetRoles(id)
+	if err != nil {
+		return export, err
+	}
+	export.Roles = map[string]string{}
+	for username, role := range roles {
+		if role != RoleParticipant {
+			export.Roles[username] = role
+		}
+	}
+
+	budget, err := d.GetVoteBudget(id)
+	if err != nil {
+		return export, err
+	}
+	export.VoteBudget = VoteBudgetExport{PerUser: budget.PerUser, PerCard: budget.PerCard}
+
+	columns, err := d.GetColumns(id)
+	if err != nil {
+		return export, err
+	}
+
+	for _, column := range columns {
+		columnExport := ColumnExport{
+			Id:    column.Id,
+			Name:  column.Name,
+			Order: column.Order,
+		}
+
+		cards, err := d.GetCards("", column.Id)
+		if err != nil {
+			return export, err
+		}
+
+		for _, card := range cards {
+			cardExport := CardExport{
+				Id:         card.Id,
+				Revealed:   card.Revealed,
+				TotalVotes: card.TotalVotes,
+			}
+
+			if cardExport.Votes, err = d.getVotesByUser(card.Id); err != nil {
+				return export, err
+			}
+
+			contents, err := d.GetContents(card.Id)
+			if err != nil {
+				return export, err
+			}
+			for _, content := range contents {
+				cardExport.Contents = append(cardExport.Contents, ContentExport{
+					Id:     content.Id,
+					Text:   content.Text,
+					Author: content.Author,
+				})
+			}
+
+			columnExport.Cards = append(columnExport.Cards, cardExport)
+		}
+
+		sort.SliceStable(columnExport.Cards, func(i, j int) bool {
+			return columnExport.Cards[i].TotalVotes > columnExport.Cards[j].TotalVotes
+		})
+
+		export.Columns = append(export.Columns, columnExport)
+	}
+
+	actions, err := d.GetActions(id)
+	if err != nil {
+		return export, err
+	}
+	for _, action := range actions {
+		export.Actions = append(export.Actions, ActionExport{
+			Id:     action.Id,
+			Card:   action.Card,
+			Text:   action.Text,
+			Owner:  action.Owner,
+			Due:    action.Due,
+			Status: action.Status,
+		})
+	}
+
+	return export, nil
+}
+
+func (d *Database) getVotesByUser(cardId string) (map[string]int, error) {
+	rows, err := d.db.Query("SELECT COALESCE(Username, ''), COUNT(*) FROM votes WHERE Card=? GROUP BY Username",
+		cardId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := map[string]int{}
+	for rows.Next() {
+		var username string
+		var count int
+		if err = rows.Scan(&username, &count); err != nil {
+			return votes, err
+		}
+		votes[username] = count
+	}
+
+	return votes, rows.Err()
+}
@@ -0,0 +1,106 @@
+package database
+
+// SetMemberships replaces the groups, such as GitHub organisations and teams,
+// that the user is recorded as being in.
+func (d *Database) SetMemberships(username string, groups []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(query, args...)
+	}
+
+	exec("DELETE FROM memberships WHERE Username = ?",
+		username)
+
+	for _, group := range groups {
+		exec(d.dialect.insertOrIgnore("memberships", "Username", "Name"),
+			username,
+			group)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) GetMemberships(username string) (groups []string, err error) {
+	rows, err := d.db.Query("SELECT Name FROM memberships WHERE Username = ? ORDER BY Name",
+		username)
+	if err != nil {
+		return groups, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group string
+		if err = rows.Scan(&group); err != nil {
+			return groups, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// AddRetroGroup shares the retro with everyone in the group.
+func (d *Database) AddRetroGroup(retroId, group string) error {
+	_, err := d.db.Exec(d.dialect.insertOrIgnore("retro_groups", "Retro", "Name"),
+		retroId,
+		group)
+
+	return err
+}
+
+func (d *Database) DeleteRetroGroup(retroId, group string) error {
+	_, err := d.db.Exec("DELETE FROM retro_groups WHERE Retro = ? AND Name = ?",
+		retroId,
+		group)
+
+	return err
+}
+
+func (d *Database) GetRetroGroups(retroId string) (groups []string, err error) {
+	rows, err := d.db.Query("SELECT Name FROM retro_groups WHERE Retro = ? ORDER BY Name",
+		retroId)
+	if err != nil {
+		return groups, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group string
+		if err = rows.Scan(&group); err != nil {
+			return groups, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// InRetroGroup checks whether the user is in any of the groups that the retro
+// has been shared with.
+func (d *Database) InRetroGroup(retroId, username string) (bool, error) {
+	row := d.db.QueryRow(`
+    SELECT COUNT(*)
+    FROM retro_groups
+    INNER JOIN memberships
+      ON retro_groups.Name = memberships.Name
+    WHERE retro_groups.Retro = ? AND memberships.Username = ?`,
+		retroId,
+		username)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count > 0, err
+}
@@ -0,0 +1,97 @@
+package database
+
+// ImportRetro adds a retro, and everything in it, from an export. Everything is
+// added in a single transaction so a failure leaves the database unchanged.
+// Users are never created, so every participant must already be a user. Cards
+// and votes without a user, such as those by people who are not users, are
+// given an empty author or username.
+func (d *Database) ImportRetro(retro RetroExport) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(query, args...)
+	}
+
+	exec("INSERT INTO retros(Id, Name, Stage, CreatedAt, Anonymous) VALUES (?, ?, ?, ?, ?)",
+		retro.Id,
+		retro.Name,
+		retro.Stage,
+		retro.CreatedAt,
+		retro.Anonymous)
+
+	for _, participant := range retro.Participants {
+		role := retro.Roles[participant]
+		if role == "" {
+			role = RoleParticipant
+		}
+
+		exec("INSERT INTO participants(Retro, Username, Role) VALUES (?, ?, ?)",
+			retro.Id,
+			participant,
+			role)
+	}
+
+	exec("INSERT INTO vote_budgets(Retro, PerUser, PerCard) VALUES (?, ?, ?)",
+		retro.Id,
+		retro.VoteBudget.PerUser,
+		retro.VoteBudget.PerCard)
+
+	for _, column := range retro.Columns {
+		exec("INSERT INTO columns(Id, Retro, Name, \"Order\") VALUES (?, ?, ?, ?)",
+			column.Id,
+			retro.Id,
+			column.Name,
+			column.Order)
+
+		for _, card := range column.Cards {
+			exec("INSERT INTO cards(Id, \"Column\", Revealed) VALUES (?, ?, ?)",
+				card.Id,
+				column.Id,
+				card.Revealed)
+
+			for _, content := range card.Contents {
+				exec("INSERT INTO contents(Id, Card, Text, Author) VALUES (?, ?, ?, ?)",
+					content.Id,
+					card.Id,
+					content.Text,
+					nullable(content.Author))
+			}
+
+			for username, count := range card.Votes {
+				for i := 0; i < count; i++ {
+					exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
+						nullable(username),
+						card.Id)
+				}
+			}
+		}
+	}
+
+	for _, action := range retro.Actions {
+		exec("INSERT INTO actions(Id, Retro, Card, Text, Owner, Due, Status) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			action.Id,
+			retro.Id,
+			action.Card,
+			action.Text,
+			action.Owner,
+			action.Due,
+			action.Status)
+
+		exec("INSERT INTO retro_actions(Retro, Action) VALUES (?, ?)",
+			retro.Id,
+			action.Id)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,497 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew is returned by Open when the database has had migrations
+// applied that this version of retro does not know about.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// migrate applies, in order, each of the dialect's migrations that have not yet
+// been applied. The number of migrations applied is recorded in the
+// schema_version table. Each migration runs in its own transaction.
+func (d *Database) migrate() error {
+	_, err := d.db.Exec("CREATE TABLE IF NOT EXISTS schema_version (Version INTEGER)")
+	if err != nil {
+		return err
+	}
+
+	var version int
+	row := d.db.QueryRow("SELECT COALESCE(MAX(Version), 0) FROM schema_version")
+	if err = row.Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(d.dialect.migrations) {
+		return fmt.Errorf("%w: found version %d, expected at most %d",
+			ErrSchemaTooNew, version, len(d.dialect.migrations))
+	}
+
+	for i, migration := range d.dialect.migrations[version:] {
+		if err = d.applyMigration(version+i+1, migration); err != nil {
+			return fmt.Errorf("migration %d: %v", version+i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Database) applyMigration(version int, migration string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(migration); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Exec("INSERT INTO schema_version(Version) VALUES (?)", version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqliteMigrations and postgresMigrations must be kept in step, so that the
+// same version number means the same schema for each database. Migrations must
+// never be changed once released, add a new one instead.
+//
+// The first migration creates the schema as it was before migrations were
+// introduced, so uses "IF NOT EXISTS" to allow existing databases to be
+// upgraded.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`
+    CREATE TABLE IF NOT EXISTS users (
+      Username  TEXT PRIMARY KEY,
+      Secret    TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS retros (
+      Id        TEXT PRIMARY KEY,
+      Name      TEXT,
+      Stage     TEXT,
+      CreatedAt DATETIME
+    );
+
+    CREATE TABLE IF NOT EXISTS participants (
+      Retro     TEXT,
+      Username  TEXT,
+      PRIMARY KEY(Username, Retro),
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS columns (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Name      TEXT,
+      "Order"   INTEGER,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS cards (
+      Id        TEXT PRIMARY KEY,
+      "Column"  TEXT,
+      Revealed  BOOLEAN,
+      FOREIGN KEY("Column") REFERENCES columns(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS contents (
+      Id        TEXT PRIMARY KEY,
+      Card      TEXT,
+      Text      TEXT,
+      Author    TEXT,
+      FOREIGN KEY(Card) REFERENCES cards(Id),
+      FOREIGN KEY(Author) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS votes (
+      Id        INTEGER PRIMARY KEY,
+      Username  TEXT,
+      Card      TEXT,
+      FOREIGN KEY(Username) REFERENCES users(Username),
+      FOREIGN KEY(Card) REFERENCES cards(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS templates (
+      Id        TEXT PRIMARY KEY,
+      Name      TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS template_columns (
+      Template  TEXT,
+      Name      TEXT,
+      "Order"   INTEGER,
+      FOREIGN KEY(Template) REFERENCES templates(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS actions (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Card      TEXT,
+      Text      TEXT,
+      Owner     TEXT,
+      Due       DATETIME,
+      Status    TEXT,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS retro_actions (
+      Retro     TEXT,
+      Action    TEXT,
+      PRIMARY KEY(Retro, Action),
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Action) REFERENCES actions(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS facilitators (
+      Retro     TEXT PRIMARY KEY,
+      Username  TEXT,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS vote_budgets (
+      Retro     TEXT PRIMARY KEY,
+      PerUser   INTEGER,
+      PerCard   INTEGER,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 2: card revisions
+	`
+    CREATE TABLE revisions (
+      Id        INTEGER PRIMARY KEY,
+      Retro     TEXT,
+      Kind      TEXT,
+      Card      TEXT,
+      CardFrom  TEXT,
+      Content   TEXT,
+      Text      TEXT,
+      Before    TEXT,
+      Author    TEXT,
+      CreatedAt DATETIME,
+      Undone    BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Author) REFERENCES users(Username)
+    );
+
+    CREATE INDEX revisions_card ON revisions(Card);
+    CREATE INDEX revisions_card_from ON revisions(CardFrom);
+    CREATE INDEX revisions_author ON revisions(Retro, Author);
+`,
+
+	// 3: anonymous retros
+	`ALTER TABLE retros ADD COLUMN Anonymous BOOLEAN NOT NULL DEFAULT 0`,
+
+	// 4: participant roles, replacing facilitators. Facilitators were the
+	// creators of retros, so become owners. Retros without a facilitator could
+	// be run by anyone, so all of their participants become facilitators.
+	`
+    ALTER TABLE participants ADD COLUMN Role TEXT NOT NULL DEFAULT 'participant';
+
+    UPDATE participants SET Role = 'owner'
+    WHERE EXISTS (SELECT 1 FROM facilitators
+                  WHERE facilitators.Retro = participants.Retro
+                    AND facilitators.Username = participants.Username);
+
+    UPDATE participants SET Role = 'facilitator'
+    WHERE NOT EXISTS (SELECT 1 FROM facilitators
+                      WHERE facilitators.Retro = participants.Retro);
+
+    DROP TABLE facilitators;
+`,
+
+	// 5: share tokens for observers
+	`
+    CREATE TABLE shares (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      TokenHash TEXT UNIQUE,
+      CreatedBy TEXT,
+      CreatedAt DATETIME,
+      ExpiresAt DATETIME,
+      Revoked   BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(CreatedBy) REFERENCES users(Username)
+    );
+`,
+
+	// 6: retro timers
+	`
+    CREATE TABLE timers (
+      Retro     TEXT PRIMARY KEY,
+      Deadline  INTEGER,
+      Remaining INTEGER,
+      Paused    BOOLEAN,
+      Advance   BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 7: group memberships, and retros shared with groups
+	`
+    CREATE TABLE memberships (
+      Username  TEXT,
+      Name      TEXT,
+      PRIMARY KEY (Username, Name),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE retro_groups (
+      Retro     TEXT,
+      Name      TEXT,
+      PRIMARY KEY (Retro, Name),
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 8: sessions, which refresh tokens are issued for
+	`
+    CREATE TABLE sessions (
+      Id           TEXT PRIMARY KEY,
+      Username     TEXT,
+      TokenHash    TEXT UNIQUE,
+      PreviousHash TEXT,
+      CreatedAt    DATETIME,
+      ExpiresAt    DATETIME,
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+`,
+
+	// 9: owners for retros that migration 4 left without one. Who created a
+	// retro is not recorded, and Postgres does not keep the order participants
+	// were added in, so for both databases the first participant by name
+	// becomes owner.
+	`
+    UPDATE participants SET Role = 'owner'
+    WHERE NOT EXISTS (SELECT 1 FROM participants owners
+                      WHERE owners.Retro = participants.Retro
+                        AND owners.Role = 'owner')
+      AND Username = (SELECT MIN(Username) FROM participants earliest
+                      WHERE earliest.Retro = participants.Retro);
+`,
+}
+
+var postgresMigrations = []string{
+	// 1: initial schema
+	`
+    CREATE TABLE IF NOT EXISTS users (
+      Username  TEXT PRIMARY KEY,
+      Secret    TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS retros (
+      Id        TEXT PRIMARY KEY,
+      Name      TEXT,
+      Stage     TEXT,
+      CreatedAt TIMESTAMPTZ
+    );
+
+    CREATE TABLE IF NOT EXISTS participants (
+      Retro     TEXT,
+      Username  TEXT,
+      PRIMARY KEY(Username, Retro),
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS columns (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Name      TEXT,
+      "Order"   INTEGER,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS cards (
+      Id        TEXT PRIMARY KEY,
+      "Column"  TEXT,
+      Revealed  BOOLEAN,
+      FOREIGN KEY("Column") REFERENCES columns(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS contents (
+      Id        TEXT PRIMARY KEY,
+      Card      TEXT,
+      Text      TEXT,
+      Author    TEXT,
+      FOREIGN KEY(Card) REFERENCES cards(Id),
+      FOREIGN KEY(Author) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS votes (
+      Id        SERIAL PRIMARY KEY,
+      Username  TEXT,
+      Card      TEXT,
+      FOREIGN KEY(Username) REFERENCES users(Username),
+      FOREIGN KEY(Card) REFERENCES cards(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS templates (
+      Id        TEXT PRIMARY KEY,
+      Name      TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS template_columns (
+      Template  TEXT,
+      Name      TEXT,
+      "Order"   INTEGER,
+      FOREIGN KEY(Template) REFERENCES templates(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS actions (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Card      TEXT,
+      Text      TEXT,
+      Owner     TEXT,
+      Due       TIMESTAMPTZ,
+      Status    TEXT,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS retro_actions (
+      Retro     TEXT,
+      Action    TEXT,
+      PRIMARY KEY(Retro, Action),
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Action) REFERENCES actions(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS facilitators (
+      Retro     TEXT PRIMARY KEY,
+      Username  TEXT,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS vote_budgets (
+      Retro     TEXT PRIMARY KEY,
+      PerUser   INTEGER,
+      PerCard   INTEGER,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 2: card revisions
+	`
+    CREATE TABLE revisions (
+      Id        SERIAL PRIMARY KEY,
+      Retro     TEXT,
+      Kind      TEXT,
+      Card      TEXT,
+      CardFrom  TEXT,
+      Content   TEXT,
+      Text      TEXT,
+      Before    TEXT,
+      Author    TEXT,
+      CreatedAt TIMESTAMPTZ,
+      Undone    BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Author) REFERENCES users(Username)
+    );
+
+    CREATE INDEX revisions_card ON revisions(Card);
+    CREATE INDEX revisions_card_from ON revisions(CardFrom);
+    CREATE INDEX revisions_author ON revisions(Retro, Author);
+`,
+
+	// 3: anonymous retros
+	`ALTER TABLE retros ADD COLUMN Anonymous BOOLEAN NOT NULL DEFAULT false`,
+
+	// 4: participant roles, replacing facilitators. Facilitators were the
+	// creators of retros, so become owners. Retros without a facilitator could
+	// be run by anyone, so all of their participants become facilitators.
+	`
+    ALTER TABLE participants ADD COLUMN Role TEXT NOT NULL DEFAULT 'participant';
+
+    UPDATE participants SET Role = 'owner'
+    WHERE EXISTS (SELECT 1 FROM facilitators
+                  WHERE facilitators.Retro = participants.Retro
+                    AND facilitators.Username = participants.Username);
+
+    UPDATE participants SET Role = 'facilitator'
+    WHERE NOT EXISTS (SELECT 1 FROM facilitators
+                      WHERE facilitators.Retro = participants.Retro);
+
+    DROP TABLE facilitators;
+`,
+
+	// 5: share tokens for observers
+	`
+    CREATE TABLE shares (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      TokenHash TEXT UNIQUE,
+      CreatedBy TEXT,
+      CreatedAt TIMESTAMPTZ,
+      ExpiresAt TIMESTAMPTZ,
+      Revoked   BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(CreatedBy) REFERENCES users(Username)
+    );
+`,
+
+	// 6: retro timers
+	`
+    CREATE TABLE timers (
+      Retro     TEXT PRIMARY KEY,
+      Deadline  BIGINT,
+      Remaining BIGINT,
+      Paused    BOOLEAN,
+      Advance   BOOLEAN,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 7: group memberships, and retros shared with groups
+	`
+    CREATE TABLE memberships (
+      Username  TEXT,
+      Name      TEXT,
+      PRIMARY KEY (Username, Name),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE retro_groups (
+      Retro     TEXT,
+      Name      TEXT,
+      PRIMARY KEY (Retro, Name),
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+`,
+
+	// 8: sessions, which refresh tokens are issued for
+	`
+    CREATE TABLE sessions (
+      Id           TEXT PRIMARY KEY,
+      Username     TEXT,
+      TokenHash    TEXT UNIQUE,
+      PreviousHash TEXT,
+      CreatedAt    TIMESTAMPTZ,
+      ExpiresAt    TIMESTAMPTZ,
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+`,
+
+	// 9: owners for retros that migration 4 left without one. Who created a
+	// retro is not recorded, and Postgres does not keep the order participants
+	// were added in, so for both databases the first participant by name
+	// becomes owner.
+	`
+    UPDATE participants SET Role = 'owner'
+    WHERE NOT EXISTS (SELECT 1 FROM participants owners
+                      WHERE owners.Retro = participants.Retro
+                        AND owners.Role = 'owner')
+      AND Username = (SELECT MIN(Username) FROM participants earliest
+                      WHERE earliest.Retro = participants.Retro);
+`,
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// baselineSchema is the schema that databases had before migrations were
+// introduced.
+const baselineSchema = `
+    CREATE TABLE IF NOT EXISTS users (
+      Username  TEXT PRIMARY KEY,
+      Secret    TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS retros (
+      Id        TEXT PRIMARY KEY,
+      Name      TEXT,
+      Stage     TEXT,
+      CreatedAt DATETIME
+    );
+
+    CREATE TABLE IF NOT EXISTS participants (
+      Retro     TEXT,
+      Username  TEXT,
+      PRIMARY KEY(Username, Retro),
+      FOREIGN KEY(Retro) REFERENCES retros(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS columns (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Name      TEXT,
+      "Order"   INTEGER,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS cards (
+      Id        TEXT PRIMARY KEY,
+      Column    TEXT,
+      Revealed  BOOLEAN,
+      FOREIGN KEY(Column) REFERENCES columns(Id)
+    );
+
+    CREATE TABLE IF NOT EXISTS contents (
+      Id        TEXT PRIMARY KEY,
+      Card      TEXT,
+      Text      TEXT,
+      Author    TEXT,
+      FOREIGN KEY(Card) REFERENCES cards(Id),
+      FOREIGN KEY(Author) REFERENCES users(Username)
+    );
+
+    CREATE TABLE IF NOT EXISTS votes (
+      Id        INTEGER PRIMARY KEY,
+      Username  TEXT,
+      Card      TEXT,
+      FOREIGN KEY(Username) REFERENCES users(Username),
+      FOREIGN KEY(Card) REFERENCES cards(Id)
+    );
+`
+
+func tempDatabasePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "retro")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "db"), func() { os.RemoveAll(dir) }
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	path, cleanup := tempDatabasePath(t)
+	defer cleanup()
+
+	createdAt := time.Date(2017, 6, 5, 4, 3, 2, 0, time.UTC)
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		baselineSchema,
+		"INSERT INTO users(Username, Secret) VALUES ('alice', 'a'), ('bob', 'b')",
+		"INSERT INTO retros(Id, Name, Stage) VALUES ('r1', 'Old', 'Voting')",
+		"INSERT INTO participants(Retro, Username) VALUES ('r1', 'bob'), ('r1', 'alice')",
+		`INSERT INTO columns(Id, Retro, Name, "Order") VALUES ('c1', 'r1', 'Start', 0), ('c2', 'r1', 'Stop', 1)`,
+		"INSERT INTO cards(Id, Column, Revealed) VALUES ('a', 'c1', 1)",
+		"INSERT INTO contents(Id, Card, Text, Author) VALUES ('a1', 'a', 'hello', 'bob')",
+		"INSERT INTO votes(Username, Card) VALUES ('alice', 'a'), ('alice', 'a'), ('bob', 'a')",
+	} {
+		if _, err := raw.Exec(query); err != nil {
+			raw.Close()
+			t.Fatal(err)
+		}
+	}
+	_, err = raw.Exec("UPDATE retros SET CreatedAt = ? WHERE Id = 'r1'", createdAt)
+	raw.Close()
+	must(t, err)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var version int
+	must(t, db.db.QueryRow("SELECT MAX(Version) FROM schema_version").Scan(&version))
+	assertEqual(t, "version", len(sqliteMigrations), version)
+
+	user, err := db.GetUser("bob")
+	must(t, err)
+	assertEqual(t, "secret", "b", user.Secret)
+
+	exported, err := db.ExportRetro("r1")
+	must(t, err)
+	assertEqual(t, "name", "Old", exported.Name)
+	assertEqual(t, "stage", "Voting", exported.Stage)
+	assertEqual(t, "created at", true, exported.CreatedAt.Equal(createdAt))
+	assertEqual(t, "anonymous", false, exported.Anonymous)
+	assertEqual(t, "columns", 2, len(exported.Columns))
+	assertEqual(t, "cards", []CardExport{{
+		Id:         "a",
+		Revealed:   true,
+		TotalVotes: 3,
+		Votes:      map[string]int{"alice": 2, "bob": 1},
+		Contents:   []ContentExport{{Id: "a1", Text: "hello", Author: "bob"}},
+	}}, exported.Columns[0].Cards)
+
+	// there was no facilitator, so anyone could run the retro, and the first
+	// participant by name owns it, though bob was added first
+	role, err := db.GetRole("r1", "alice")
+	must(t, err)
+	assertEqual(t, "alice's role", RoleOwner, role)
+	role, err = db.GetRole("r1", "bob")
+	must(t, err)
+	assertEqual(t, "bob's role", RoleFacilitator, role)
+
+	// the migrated database can be used as normal
+	must(t, db.VoteWithinBudget("r1", "bob", "a"))
+	must(t, db.Close())
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("could not reopen migrated database: %v", err)
+	}
+	defer db.Close()
+
+	count, err := db.CountVotes("r1", "bob")
+	must(t, err)
+	assertEqual(t, "votes after reopening", 2, count)
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	path, cleanup := tempDatabasePath(t)
+	defer cleanup()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec("INSERT INTO schema_version(Version) VALUES (?)", len(sqliteMigrations)+1)
+	db.Close()
+	must(t, err)
+
+	db, err = Open(path)
+	if err == nil {
+		db.Close()
+		t.Fatal("expected error opening database with a newer schema")
+	}
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected %v, was %v", ErrSchemaTooNew, err)
+	}
+}
@@ -16,6 +16,17 @@ func (d *Database) DeleteParticipant(retroId, username string) error {
 	return err
 }
 
+func (d *Database) IsParticipant(retroId, username string) (bool, error) {
+	row := d.db.QueryRow("SELECT COUNT(*) FROM participants WHERE Retro = ? AND Username = ?",
+		retroId,
+		username)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count > 0, err
+}
+
 func (d *Database) GetParticipants(retroId string) (participants []string, err error) {
 	rows, err := d.db.Query("SELECT Username FROM participants WHERE Retro = ?",
 		retroId)
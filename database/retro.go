@@ -1,42 +1,62 @@
 package database
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrRetroHasCards is returned when a retro's anonymity is turned off after
+// cards have been written, as it would show who wrote them.
+var ErrRetroHasCards = errors.New("retro has cards")
 
 type Retro struct {
 	Id        string
 	Name      string
 	Stage     string
 	CreatedAt time.Time
+
+	// Anonymous retros do not show who wrote each card, except to the author.
+	Anonymous bool
 }
 
 func (d *Database) AddRetro(retro Retro) error {
-	_, err := d.db.Exec("INSERT INTO retros(Id, Name, Stage, CreatedAt) VALUES (?, ?, ?, ?)",
+	_, err := d.db.Exec("INSERT INTO retros(Id, Name, Stage, CreatedAt, Anonymous) VALUES (?, ?, ?, ?, ?)",
 		retro.Id,
 		retro.Name,
 		retro.Stage,
-		retro.CreatedAt)
+		retro.CreatedAt,
+		retro.Anonymous)
 
 	return err
 }
 
 func (d *Database) GetRetro(id string) (Retro, error) {
-	row := d.db.QueryRow("SELECT Id, Name, Stage, CreatedAt FROM retros WHERE Id=?",
+	row := d.db.QueryRow("SELECT Id, Name, Stage, CreatedAt, Anonymous FROM retros WHERE Id=?",
 		id)
 
 	var retro Retro
-	err := row.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt)
+	err := row.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt, &retro.Anonymous)
 
 	return retro, err
 }
 
+// GetRetros returns the retros that the user is a participant of, or that have
+// been shared with one of their groups.
 func (d *Database) GetRetros(username string) (retros []Retro, err error) {
 	rows, err := d.db.Query(`
-    SELECT retros.Id, retros.Name, retros.Stage, retros.CreatedAt
+    SELECT retros.Id, retros.Name, retros.Stage, retros.CreatedAt, retros.Anonymous
     FROM retros
-    INNER JOIN participants
-      ON retros.Id = participants.Retro
-    WHERE participants.Username = ?
+    WHERE retros.Id IN (
+      SELECT Retro FROM participants WHERE Username = ?
+    ) OR retros.Id IN (
+      SELECT retro_groups.Retro
+      FROM retro_groups
+      INNER JOIN memberships
+        ON retro_groups.Name = memberships.Name
+      WHERE memberships.Username = ?
+    )
     ORDER BY retros.CreatedAt`,
+		username,
 		username)
 	if err != nil {
 		return retros, err
@@ -45,7 +65,7 @@ func (d *Database) GetRetros(username string) (retros []Retro, err error) {
 
 	for rows.Next() {
 		var retro Retro
-		if err = rows.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt); err != nil {
+		if err = rows.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt, &retro.Anonymous); err != nil {
 			return retros, err
 		}
 		retros = append(retros, retro)
@@ -61,3 +81,29 @@ func (d *Database) SetStage(id, stage string) error {
 
 	return err
 }
+
+// SetAnonymous changes whether the retro is anonymous. Anonymity can only be
+// turned off while the retro has no cards, otherwise ErrRetroHasCards is
+// returned.
+func (d *Database) SetAnonymous(id string, anonymous bool) error {
+	result, err := d.db.Exec(`
+    UPDATE retros SET Anonymous=?
+    WHERE Id=? AND (? OR NOT EXISTS (SELECT 1 FROM cards
+                                     INNER JOIN columns ON cards."Column" = columns.Id
+                                     WHERE columns.Retro = retros.Id))`,
+		anonymous,
+		id,
+		anonymous)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrRetroHasCards
+		}
+		return err
+	}
+
+	return nil
+}
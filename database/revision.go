@@ -0,0 +1,321 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The kinds of change that are recorded as revisions.
+const (
+	RevisionAdd     = "add"
+	RevisionEdit    = "edit"
+	RevisionMove    = "move"
+	RevisionReveal  = "reveal"
+	RevisionGroup   = "group"
+	RevisionDelete  = "delete"
+	RevisionUngroup = "ungroup"
+)
+
+// A Revision records a change to a card, or to its contents, so that it can be
+// shown in the card's history and undone.
+type Revision struct {
+	Id    int64
+	Retro string
+	Kind  string
+
+	// Card is the card that was changed. For a group or ungroup, contents were
+	// moved from CardFrom to Card.
+	Card     string
+	CardFrom string
+
+	// Content is set when a single content was added or edited, and Text is its
+	// new text.
+	Content string
+	Text    string
+
+	// Before is the state of the card, or for a group or ungroup of CardFrom,
+	// before the change. It is nil when the card did not exist.
+	Before *CardState
+
+	Author    string
+	CreatedAt time.Time
+	Undone    bool
+}
+
+// CardState is a complete copy of a card.
+type CardState struct {
+	Card     Card
+	Contents []Content
+	Votes    []CardVote
+}
+
+type CardVote struct {
+	Id       int64
+	Username string
+}
+
+// GetCardState reads the card, its contents and its votes.
+func (d *Database) GetCardState(id string) (CardState, error) {
+	var state CardState
+	var err error
+
+	if state.Card, err = d.GetCard(id); err != nil {
+		return state, err
+	}
+	if state.Contents, err = d.GetContents(id); err != nil {
+		return state, err
+	}
+
+	rows, err := d.db.Query("SELECT Id, COALESCE(Username, '') FROM votes WHERE Card=? ORDER BY Id",
+		id)
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vote CardVote
+		if err = rows.Scan(&vote.Id, &vote.Username); err != nil {
+			return state, err
+		}
+		state.Votes = append(state.Votes, vote)
+	}
+	state.Card.TotalVotes = len(state.Votes)
+
+	return state, rows.Err()
+}
+
+func (d *Database) AddRevision(revision Revision) error {
+	before, err := encodeCardState(revision.Before)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`
+    INSERT INTO revisions(Retro, Kind, Card, CardFrom, Content, Text, Before, Author, CreatedAt, Undone)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		revision.Retro,
+		revision.Kind,
+		revision.Card,
+		revision.CardFrom,
+		revision.Content,
+		revision.Text,
+		before,
+		revision.Author,
+		revision.CreatedAt,
+		false)
+
+	return err
+}
+
+const revisionColumns = "Id, Retro, Kind, Card, CardFrom, Content, Text, Before, Author, CreatedAt, Undone"
+
+// GetLastRevision returns the latest change made by author in the retro that
+// has not been undone.
+func (d *Database) GetLastRevision(retroId, author string) (Revision, error) {
+	row := d.db.QueryRow("SELECT "+revisionColumns+" FROM revisions WHERE Retro=? AND Author=? AND Undone=? ORDER BY Id DESC LIMIT 1",
+		retroId,
+		author,
+		false)
+
+	return scanRevision(row)
+}
+
+// IsLatestRevision checks that no other changes, that have not been undone, were
+// made to the cards changed by revision after it.
+func (d *Database) IsLatestRevision(revision Revision) (bool, error) {
+	cardFrom := revision.CardFrom
+	if cardFrom == "" {
+		cardFrom = revision.Card
+	}
+
+	row := d.db.QueryRow(`
+    SELECT COUNT(*)
+    FROM revisions
+    WHERE Id > ? AND Undone = ? AND (Card IN (?, ?) OR CardFrom IN (?, ?))`,
+		revision.Id,
+		false,
+		revision.Card, cardFrom,
+		revision.Card, cardFrom)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count == 0, err
+}
+
+// GetCardRevisions lists the changes made to the card, oldest first.
+func (d *Database) GetCardRevisions(cardId string) (revisions []Revision, err error) {
+	rows, err := d.db.Query("SELECT "+revisionColumns+" FROM revisions WHERE Card=? OR CardFrom=? ORDER BY Id",
+		cardId,
+		cardId)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// UndoRevision reverts the change made in revision, and marks it as undone.
+// Votes made after the change are kept, but votes that are put back are dropped
+// if they would take a user over the retro's vote budget. ErrColumnDeleted is returned if the card
+// would be put back in a column that has since been deleted.
+func (d *Database) UndoRevision(revision Revision) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(query, args...)
+	}
+
+	before := revision.Before
+	if before == nil {
+		before = &CardState{}
+	}
+
+	switch revision.Kind {
+	case RevisionMove, RevisionDelete, RevisionGroup:
+		// the card is put back in the column it was in, which may have been
+		// deleted since
+		var columns int
+		err = tx.QueryRow("SELECT COUNT(*) FROM columns WHERE Id=?", before.Card.Column).Scan(&columns)
+		if err == nil && columns == 0 {
+			err = ErrColumnDeleted
+		}
+	}
+
+	switch revision.Kind {
+	case RevisionAdd:
+		exec("DELETE FROM votes WHERE Card=?", revision.Card)
+		exec("DELETE FROM contents WHERE Card=?", revision.Card)
+		exec("DELETE FROM cards WHERE Id=?", revision.Card)
+
+	case RevisionEdit:
+		for _, content := range before.Contents {
+			if content.Id == revision.Content {
+				exec("UPDATE contents SET Text=? WHERE Id=?", content.Text, content.Id)
+			}
+		}
+
+	case RevisionMove:
+		exec("UPDATE cards SET \"Column\"=? WHERE Id=?", before.Card.Column, revision.Card)
+
+	case RevisionReveal:
+		exec("UPDATE cards SET Revealed=? WHERE Id=?", before.Card.Revealed, revision.Card)
+
+	case RevisionDelete:
+		exec("INSERT INTO cards(Id, \"Column\", Revealed) VALUES (?, ?, ?)",
+			before.Card.Id, before.Card.Column, before.Card.Revealed)
+		for _, content := range before.Contents {
+			exec("INSERT INTO contents(Id, Card, Text, Author) VALUES (?, ?, ?, ?)",
+				content.Id, before.Card.Id, content.Text, nullable(content.Author))
+		}
+		for _, vote := range before.Votes {
+			if err == nil {
+				err = restoreVote(tx, vote, before.Card.Id)
+			}
+		}
+		if err == nil {
+			err = dropVotesOverBudget(tx, revision.Retro, before.Card.Id)
+		}
+
+	case RevisionGroup:
+		exec("INSERT INTO cards(Id, \"Column\", Revealed) VALUES (?, ?, ?)",
+			before.Card.Id, before.Card.Column, before.Card.Revealed)
+		for _, content := range before.Contents {
+			exec("UPDATE contents SET Card=? WHERE Id=? AND Card=?",
+				before.Card.Id, content.Id, revision.Card)
+		}
+		for _, vote := range before.Votes {
+			exec("UPDATE votes SET Card=? WHERE Id=? AND Card=?",
+				before.Card.Id, vote.Id, revision.Card)
+		}
+
+	case RevisionUngroup:
+		exec("UPDATE contents SET Card=? WHERE Card=?", revision.CardFrom, revision.Card)
+		exec("UPDATE votes SET Card=? WHERE Card=?", revision.CardFrom, revision.Card)
+		for _, vote := range before.Votes {
+			exec("DELETE FROM votes WHERE Id=?", vote.Id)
+			exec("INSERT INTO votes(Id, Username, Card) VALUES (?, ?, ?)",
+				vote.Id, nullable(vote.Username), revision.CardFrom)
+		}
+		exec("DELETE FROM cards WHERE Id=?", revision.Card)
+		if err == nil {
+			err = dropVotesOverBudget(tx, revision.Retro, revision.CardFrom)
+		}
+	}
+
+	exec("UPDATE revisions SET Undone=? WHERE Id=?", true, revision.Id)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// restoreVote puts back a deleted vote on the card. It keeps its id, unless that
+// has been given to a vote made since, so that earlier revisions can still find
+// it.
+func restoreVote(db *tx, vote CardVote, cardId string) error {
+	var taken int
+	if err := db.QueryRow("SELECT COUNT(*) FROM votes WHERE Id=?", vote.Id).Scan(&taken); err != nil {
+		return err
+	}
+
+	if taken > 0 {
+		_, err := db.Exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
+			nullable(vote.Username), cardId)
+		return err
+	}
+
+	_, err := db.Exec("INSERT INTO votes(Id, Username, Card) VALUES (?, ?, ?)",
+		vote.Id, nullable(vote.Username), cardId)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRevision(row scanner) (Revision, error) {
+	var revision Revision
+	var before string
+
+	err := row.Scan(&revision.Id, &revision.Retro, &revision.Kind, &revision.Card, &revision.CardFrom,
+		&revision.Content, &revision.Text, &before, &revision.Author, &revision.CreatedAt, &revision.Undone)
+	if err != nil {
+		return revision, err
+	}
+
+	if before != "" {
+		revision.Before = &CardState{}
+		err = json.Unmarshal([]byte(before), revision.Before)
+	}
+
+	return revision, err
+}
+
+func encodeCardState(state *CardState) (string, error) {
+	if state == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(state)
+	return string(data), err
+}
@@ -0,0 +1,76 @@
+package database
+
+import "database/sql"
+
+// The roles that a participant can have in a retro, from least to most
+// privileged.
+const (
+	RoleObserver    = "observer"
+	RoleParticipant = "participant"
+	RoleFacilitator = "facilitator"
+	RoleOwner       = "owner"
+)
+
+// Roles lists every role, from least to most privileged.
+var Roles = []string{RoleObserver, RoleParticipant, RoleFacilitator, RoleOwner}
+
+// SetRole changes the role the participant has in the retro.
+func (d *Database) SetRole(retroId, username, role string) error {
+	_, err := d.db.Exec("UPDATE participants SET Role = ? WHERE Retro = ? AND Username = ?",
+		role,
+		retroId,
+		username)
+
+	return err
+}
+
+// GetRole returns the role the user has in the retro. It returns sql.ErrNoRows
+// if the user is not a participant.
+func (d *Database) GetRole(retroId, username string) (string, error) {
+	row := d.db.QueryRow("SELECT Role FROM participants WHERE Retro = ? AND Username = ?",
+		retroId,
+		username)
+
+	var role string
+	err := row.Scan(&role)
+
+	return role, err
+}
+
+// GetRoles returns the role of each participant in the retro.
+func (d *Database) GetRoles(retroId string) (map[string]string, error) {
+	roles := map[string]string{}
+
+	rows, err := d.db.Query("SELECT Username, Role FROM participants WHERE Retro = ?",
+		retroId)
+	if err != nil {
+		return roles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username, role string
+		if err = rows.Scan(&username, &role); err != nil {
+			return roles, err
+		}
+		roles[username] = role
+	}
+
+	return roles, rows.Err()
+}
+
+// GetOwner returns the username of the retro's owner, or an empty string if it
+// does not have one.
+func (d *Database) GetOwner(retroId string) (string, error) {
+	row := d.db.QueryRow("SELECT Username FROM participants WHERE Retro = ? AND Role = ?",
+		retroId,
+		RoleOwner)
+
+	var username string
+	err := row.Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return username, err
+}
@@ -0,0 +1,86 @@
+package database
+
+import "time"
+
+// A Session is created each time a user signs in. Its refresh token can be
+// swapped for a new access token, and a new refresh token, until it expires or
+// is deleted. Only hashes of refresh tokens are stored.
+type Session struct {
+	Id        string
+	Username  string
+	TokenHash string
+
+	// PreviousHash is the hash of the refresh token that TokenHash replaced, so
+	// that a refresh token being used again can be noticed.
+	PreviousHash string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (d *Database) AddSession(session Session) error {
+	_, err := d.db.Exec("INSERT INTO sessions(Id, Username, TokenHash, PreviousHash, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		session.Id,
+		session.Username,
+		session.TokenHash,
+		session.PreviousHash,
+		session.CreatedAt,
+		session.ExpiresAt)
+
+	return err
+}
+
+func (d *Database) GetSession(id string) (Session, error) {
+	row := d.db.QueryRow("SELECT Id, Username, TokenHash, PreviousHash, CreatedAt, ExpiresAt FROM sessions WHERE Id = ?",
+		id)
+
+	var session Session
+	err := row.Scan(&session.Id, &session.Username, &session.TokenHash, &session.PreviousHash, &session.CreatedAt, &session.ExpiresAt)
+
+	return session, err
+}
+
+// GetSessionByToken returns the session that the refresh token hash is for,
+// either as its current or previous refresh token.
+func (d *Database) GetSessionByToken(tokenHash string) (Session, error) {
+	row := d.db.QueryRow("SELECT Id, Username, TokenHash, PreviousHash, CreatedAt, ExpiresAt FROM sessions WHERE TokenHash = ? OR PreviousHash = ?",
+		tokenHash,
+		tokenHash)
+
+	var session Session
+	err := row.Scan(&session.Id, &session.Username, &session.TokenHash, &session.PreviousHash, &session.CreatedAt, &session.ExpiresAt)
+
+	return session, err
+}
+
+// RotateSession replaces the session's refresh token, as long as it has not
+// been replaced already. It returns false if it had been.
+func (d *Database) RotateSession(id, tokenHash, newTokenHash string, expiresAt time.Time) (bool, error) {
+	result, err := d.db.Exec("UPDATE sessions SET TokenHash = ?, PreviousHash = ?, ExpiresAt = ? WHERE Id = ? AND TokenHash = ?",
+		newTokenHash,
+		tokenHash,
+		expiresAt,
+		id,
+		tokenHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (d *Database) DeleteSession(id string) error {
+	_, err := d.db.Exec("DELETE FROM sessions WHERE Id = ?",
+		id)
+
+	return err
+}
+
+// DeleteSessions deletes every session for the user.
+func (d *Database) DeleteSessions(username string) error {
+	_, err := d.db.Exec("DELETE FROM sessions WHERE Username = ?",
+		username)
+
+	return err
+}
@@ -0,0 +1,79 @@
+package database
+
+import "time"
+
+// A Share lets anyone with its token watch a retro, without taking part, until
+// it expires or is revoked. Only a hash of the token is stored.
+type Share struct {
+	Id        string
+	Retro     string
+	TokenHash string
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+func (d *Database) AddShare(share Share) error {
+	_, err := d.db.Exec("INSERT INTO shares(Id, Retro, TokenHash, CreatedBy, CreatedAt, ExpiresAt, Revoked) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		share.Id,
+		share.Retro,
+		share.TokenHash,
+		share.CreatedBy,
+		share.CreatedAt,
+		share.ExpiresAt,
+		share.Revoked)
+
+	return err
+}
+
+// GetShareByToken returns the share with the token hash given.
+func (d *Database) GetShareByToken(tokenHash string) (Share, error) {
+	row := d.db.QueryRow("SELECT Id, Retro, TokenHash, CreatedBy, CreatedAt, ExpiresAt, Revoked FROM shares WHERE TokenHash = ?",
+		tokenHash)
+
+	var share Share
+	err := row.Scan(&share.Id, &share.Retro, &share.TokenHash, &share.CreatedBy, &share.CreatedAt, &share.ExpiresAt, &share.Revoked)
+
+	return share, err
+}
+
+func (d *Database) GetShares(retroId string) (shares []Share, err error) {
+	rows, err := d.db.Query("SELECT Id, Retro, TokenHash, CreatedBy, CreatedAt, ExpiresAt, Revoked FROM shares WHERE Retro = ? ORDER BY CreatedAt",
+		retroId)
+	if err != nil {
+		return shares, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var share Share
+		if err = rows.Scan(&share.Id, &share.Retro, &share.TokenHash, &share.CreatedBy, &share.CreatedAt, &share.ExpiresAt, &share.Revoked); err != nil {
+			return shares, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// RevokeShare stops the share from being used. It returns the share, so that
+// connections using it can be closed.
+func (d *Database) RevokeShare(retroId, id string) (Share, error) {
+	_, err := d.db.Exec("UPDATE shares SET Revoked = ? WHERE Retro = ? AND Id = ?",
+		true,
+		retroId,
+		id)
+	if err != nil {
+		return Share{}, err
+	}
+
+	row := d.db.QueryRow("SELECT Id, Retro, TokenHash, CreatedBy, CreatedAt, ExpiresAt, Revoked FROM shares WHERE Retro = ? AND Id = ?",
+		retroId,
+		id)
+
+	var share Share
+	err = row.Scan(&share.Id, &share.Retro, &share.TokenHash, &share.CreatedBy, &share.CreatedAt, &share.ExpiresAt, &share.Revoked)
+
+	return share, err
+}
@@ -0,0 +1,108 @@
+package database
+
+import "database/sql"
+
+// RetroSnapshot is everything in a retro that is shown to a user when they join
+// it. It is read using a fixed number of queries, however large the retro is.
+type RetroSnapshot struct {
+	Retro    Retro
+	Roles    map[string]string
+	Groups   []string
+	Columns  []Column
+	Cards    []Card
+	Contents []Content
+	Actions  []Action
+
+	// Timer is the retro's timer, or nil if it does not have one.
+	Timer *Timer
+}
+
+// GetRetroSnapshot reads everything in the retro. Card votes are counted for
+// username.
+func (d *Database) GetRetroSnapshot(retroId, username string) (RetroSnapshot, error) {
+	var snapshot RetroSnapshot
+	var err error
+
+	if snapshot.Retro, err = d.GetRetro(retroId); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Roles, err = d.GetRoles(retroId); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Groups, err = d.GetRetroGroups(retroId); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Columns, err = d.GetColumns(retroId); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Cards, err = d.getRetroCards(retroId, username); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Contents, err = d.getRetroContents(retroId); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Actions, err = d.GetActions(retroId); err != nil {
+		return snapshot, err
+	}
+
+	timer, err := d.GetTimer(retroId)
+	if err == sql.ErrNoRows {
+		return snapshot, nil
+	}
+	snapshot.Timer = &timer
+
+	return snapshot, err
+}
+
+func (d *Database) getRetroCards(retroId, username string) (cards []Card, err error) {
+	rows, err := d.db.Query(`
+    SELECT cards.Id,
+           cards."Column",
+           cards.Revealed,
+           SUM(CASE WHEN votes.Username = ? THEN 1 ELSE 0 END),
+           COUNT(votes.Id)
+    FROM cards
+    INNER JOIN columns ON cards."Column" = columns.Id
+    LEFT JOIN votes ON cards.Id = votes.Card
+    WHERE columns.Retro = ?
+    GROUP BY cards.Id, cards."Column", cards.Revealed`,
+		username, retroId)
+	if err != nil {
+		return cards, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var card Card
+		if err = rows.Scan(&card.Id, &card.Column, &card.Revealed, &card.Votes, &card.TotalVotes); err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+
+	return cards, rows.Err()
+}
+
+func (d *Database) getRetroContents(retroId string) (contents []Content, err error) {
+	rows, err := d.db.Query(`
+    SELECT contents.Id, contents.Card, contents.Text, COALESCE(contents.Author, '')
+    FROM contents
+    INNER JOIN cards ON contents.Card = cards.Id
+    INNER JOIN columns ON cards."Column" = columns.Id
+    WHERE columns.Retro = ?`,
+		retroId)
+	if err != nil {
+		return contents, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var content Content
+		if err = rows.Scan(&content.Id, &content.Card, &content.Text, &content.Author); err != nil {
+			return contents, err
+		}
+		contents = append(contents, content)
+	}
+
+	return contents, rows.Err()
+}
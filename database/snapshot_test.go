@@ -0,0 +1,36 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func BenchmarkSnapshot(b *testing.B) {
+	for _, cards := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(cards), func(b *testing.B) {
+			n := atomic.AddInt64(&testDatabases, 1)
+			db, err := Open(fmt.Sprintf("file:snapshot%d?mode=memory&cache=shared", n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			addTestRetro(b, db, "r1", "alice", "bob")
+			for i := 0; i < cards; i++ {
+				id := strconv.Itoa(i)
+				must(b, db.AddCard(Card{Id: id, Column: "r1-column", Revealed: i%2 == 0}))
+				must(b, db.AddContent(Content{Id: id, Card: id, Text: "card " + id, Author: "alice"}))
+				must(b, db.Vote("bob", id))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.GetRetroSnapshot("r1", "alice"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
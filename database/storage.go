@@ -0,0 +1,106 @@
+package database
+
+import "time"
+
+// Storage is implemented by Database for each of the supported databases. It
+// lists the methods needed to run retros.
+type Storage interface {
+	EnsureUser(username, secret string) error
+	GetUser(username string) (User, error)
+	GetUsers() ([]User, error)
+	SetSecret(username, secret string) error
+
+	AddSession(session Session) error
+	GetSession(id string) (Session, error)
+	GetSessionByToken(tokenHash string) (Session, error)
+	RotateSession(id, tokenHash, newTokenHash string, expiresAt time.Time) (bool, error)
+	DeleteSession(id string) error
+	DeleteSessions(username string) error
+
+	AddRetro(retro Retro) error
+	GetRetro(id string) (Retro, error)
+	GetRetros(username string) ([]Retro, error)
+	SetStage(id, stage string) error
+	SetAnonymous(id string, anonymous bool) error
+
+	AddParticipant(retroId, username string) error
+	DeleteParticipant(retroId, username string) error
+	IsParticipant(retroId, username string) (bool, error)
+	GetParticipants(retroId string) ([]string, error)
+
+	SetRole(retroId, username, role string) error
+	GetRole(retroId, username string) (string, error)
+	GetRoles(retroId string) (map[string]string, error)
+	GetOwner(retroId string) (string, error)
+
+	AddShare(share Share) error
+	GetShareByToken(tokenHash string) (Share, error)
+	GetShares(retroId string) ([]Share, error)
+	RevokeShare(retroId, id string) (Share, error)
+
+	SetTimer(timer Timer) error
+	GetTimer(retroId string) (Timer, error)
+	DeleteTimer(retroId string) error
+	GetRunningTimers() ([]Timer, error)
+
+	SetMemberships(username string, groups []string) error
+	GetMemberships(username string) ([]string, error)
+	AddRetroGroup(retroId, group string) error
+	DeleteRetroGroup(retroId, group string) error
+	GetRetroGroups(retroId string) ([]string, error)
+	InRetroGroup(retroId, username string) (bool, error)
+
+	AddColumn(column Column) error
+	GetColumn(id string) (Column, error)
+	GetColumns(retroId string) ([]Column, error)
+	RenameColumn(id, name string) error
+	ReorderColumns(retroId string, columnIds []string) error
+	DeleteColumn(id, cardsTo string, cardIds []string) error
+
+	AddCard(card Card) error
+	MoveCard(id, columnId string) error
+	RevealCard(id string) error
+	DeleteCard(id string) error
+	GroupCards(cardFrom, cardTo string) error
+	UngroupCard(ungroup Ungroup) error
+	GetCard(id string) (Card, error)
+	CountCards(columnId string) (int, error)
+	GetCards(username, columnId string) ([]Card, error)
+
+	AddContent(content Content) error
+	UpdateContent(id string, text string) error
+	GetContent(id string) (Content, error)
+	GetContents(cardId string) ([]Content, error)
+
+	Vote(username, cardId string) error
+	VoteWithinBudget(retroId, username, cardId string) error
+	Unvote(username, cardId string) error
+	CountVotes(retroId, username string) (int, error)
+	SetVoteBudget(retroId string, budget VoteBudget) error
+	GetVoteBudget(retroId string) (VoteBudget, error)
+
+	AddAction(action Action) error
+	AssignAction(id, owner string, due *time.Time) error
+	SetActionStatus(id, status string) error
+	CarryActions(retroFrom, retroTo string) error
+	IsActionInRetro(id, retroId string) (bool, error)
+	GetAction(id string) (Action, error)
+	GetActions(retroId string) ([]Action, error)
+
+	GetCardState(id string) (CardState, error)
+	AddRevision(revision Revision) error
+	GetLastRevision(retroId, author string) (Revision, error)
+	IsLatestRevision(revision Revision) (bool, error)
+	GetCardRevisions(cardId string) ([]Revision, error)
+	UndoRevision(revision Revision) error
+
+	SetTemplate(template Template) error
+	GetTemplate(id string) (Template, error)
+	GetTemplates() ([]Template, error)
+
+	GetRetroSnapshot(retroId, username string) (RetroSnapshot, error)
+	ExportRetro(id string) (RetroExport, error)
+	ImportRetro(retro RetroExport) error
+}
+
+var _ Storage = (*Database)(nil)
@@ -0,0 +1,562 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testDatabases int64
+
+// testBackends lists the databases that each storage test is run against. The
+// tests are run against Postgres when RETRO_TEST_POSTGRES is set to the URL of
+// a database that can be emptied.
+func testBackends(t *testing.T) map[string]func(t *testing.T) *Database {
+	backends := map[string]func(t *testing.T) *Database{
+		"sqlite": func(t *testing.T) *Database {
+			n := atomic.AddInt64(&testDatabases, 1)
+			db, err := Open(fmt.Sprintf("file:storage%d?mode=memory&cache=shared", n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		},
+	}
+
+	if url := os.Getenv("RETRO_TEST_POSTGRES"); url != "" {
+		backends["postgres"] = func(t *testing.T) *Database {
+			db, err := Open(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Reset(); err != nil {
+				db.Close()
+				t.Fatal(err)
+			}
+			return db
+		}
+	} else {
+		t.Log("RETRO_TEST_POSTGRES is not set, skipping postgres")
+	}
+
+	return backends
+}
+
+// addTestRetro adds a retro with a column, and the users given as participants.
+// The first user is made the owner.
+func addTestRetro(t testing.TB, db Storage, id string, usernames ...string) {
+	t.Helper()
+
+	must(t, db.AddRetro(Retro{Id: id, Name: "Retro " + id, Stage: "Thinking", CreatedAt: time.Now()}))
+	must(t, db.AddColumn(Column{Id: id + "-column", Retro: id, Name: "Start", Order: 0}))
+
+	for i, username := range usernames {
+		must(t, db.EnsureUser(username, "secret"))
+		must(t, db.AddParticipant(id, username))
+		if i == 0 {
+			must(t, db.SetRole(id, username, RoleOwner))
+		}
+	}
+}
+
+func must(t testing.TB, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertEqual(t *testing.T, name string, expected, actual interface{}) {
+	t.Helper()
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s: expected %v, was %v", name, expected, actual)
+	}
+}
+
+var storageTests = []struct {
+	name string
+	test func(t *testing.T, db Storage)
+}{
+	{"users", func(t *testing.T, db Storage) {
+		must(t, db.EnsureUser("alice", "first"))
+		must(t, db.EnsureUser("alice", "second"))
+
+		user, err := db.GetUser("alice")
+		must(t, err)
+		assertEqual(t, "secret", "first", user.Secret)
+
+		must(t, db.SetSecret("alice", "third"))
+		user, err = db.GetUser("alice")
+		must(t, err)
+		assertEqual(t, "secret", "third", user.Secret)
+
+		if _, err := db.GetUser("bob"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for missing user, was %v", err)
+		}
+	}},
+
+	{"sessions", func(t *testing.T, db Storage) {
+		must(t, db.EnsureUser("alice", "secret"))
+		now := time.Now().Truncate(time.Second)
+		must(t, db.AddSession(Session{Id: "s1", Username: "alice", TokenHash: "one", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+		must(t, db.AddSession(Session{Id: "s2", Username: "alice", TokenHash: "other", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+		ok, err := db.RotateSession("s1", "one", "two", now.Add(2*time.Hour))
+		must(t, err)
+		assertEqual(t, "rotated", true, ok)
+
+		ok, err = db.RotateSession("s1", "one", "three", now.Add(2*time.Hour))
+		must(t, err)
+		assertEqual(t, "rotated with old token", false, ok)
+
+		session, err := db.GetSessionByToken("one")
+		must(t, err)
+		assertEqual(t, "id by previous token", "s1", session.Id)
+		assertEqual(t, "token hash", "two", session.TokenHash)
+		assertEqual(t, "expires at", true, session.ExpiresAt.Equal(now.Add(2*time.Hour)))
+
+		must(t, db.DeleteSession("s1"))
+		if _, err := db.GetSession("s1"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for deleted session, was %v", err)
+		}
+
+		must(t, db.DeleteSessions("alice"))
+		if _, err := db.GetSession("s2"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for deleted session, was %v", err)
+		}
+	}},
+
+	{"retros", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice", "bob")
+		addTestRetro(t, db, "r2", "bob")
+
+		must(t, db.SetStage("r1", "Voting"))
+		must(t, db.SetAnonymous("r1", true))
+		retro, err := db.GetRetro("r1")
+		must(t, err)
+		assertEqual(t, "stage", "Voting", retro.Stage)
+		assertEqual(t, "anonymous", true, retro.Anonymous)
+
+		must(t, db.SetAnonymous("r1", false))
+		must(t, db.SetAnonymous("r1", true))
+		must(t, db.AddCard(Card{Id: "a", Column: "r1-column"}))
+		assertEqual(t, "anonymity turned off with cards", ErrRetroHasCards, db.SetAnonymous("r1", false))
+		must(t, db.SetAnonymous("r1", true))
+
+		retros, err := db.GetRetros("alice")
+		must(t, err)
+		assertEqual(t, "alice's retros", 1, len(retros))
+
+		retros, err = db.GetRetros("bob")
+		must(t, err)
+		assertEqual(t, "bob's retros", 2, len(retros))
+	}},
+
+	{"participants and roles", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice", "bob")
+
+		ok, err := db.IsParticipant("r1", "bob")
+		must(t, err)
+		assertEqual(t, "is participant", true, ok)
+
+		role, err := db.GetRole("r1", "bob")
+		must(t, err)
+		assertEqual(t, "default role", RoleParticipant, role)
+
+		must(t, db.SetRole("r1", "bob", RoleFacilitator))
+		roles, err := db.GetRoles("r1")
+		must(t, err)
+		assertEqual(t, "roles", map[string]string{"alice": RoleOwner, "bob": RoleFacilitator}, roles)
+
+		owner, err := db.GetOwner("r1")
+		must(t, err)
+		assertEqual(t, "owner", "alice", owner)
+
+		must(t, db.DeleteParticipant("r1", "bob"))
+		if _, err := db.GetRole("r1", "bob"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for role of removed participant, was %v", err)
+		}
+	}},
+
+	{"columns", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		must(t, db.AddColumn(Column{Id: "c2", Retro: "r1", Name: "Stop", Order: 1}))
+		must(t, db.AddCard(Card{Id: "card", Column: "c2"}))
+
+		must(t, db.RenameColumn("c2", "Less"))
+		must(t, db.ReorderColumns("r1", []string{"c2", "r1-column"}))
+
+		columns, err := db.GetColumns("r1")
+		must(t, err)
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		assertEqual(t, "columns", []string{"Less", "Start"}, names)
+
+		must(t, db.DeleteColumn("c2", "r1-column", nil))
+		card, err := db.GetCard("card")
+		must(t, err)
+		assertEqual(t, "moved card column", "r1-column", card.Column)
+
+		must(t, db.AddColumn(Column{Id: "c3", Retro: "r1", Name: "Keep", Order: 2}))
+		must(t, db.AddCard(Card{Id: "listed", Column: "c3"}))
+		must(t, db.AddContent(Content{Id: "listed1", Card: "listed", Text: "hi", Author: "alice"}))
+		must(t, db.Vote("alice", "listed"))
+		must(t, db.AddCard(Card{Id: "unlisted", Column: "c3"}))
+
+		assertEqual(t, "delete unlisted", ErrColumnNotEmpty, db.DeleteColumn("c3", "", []string{"listed"}))
+		_, err = db.GetCard("listed")
+		must(t, err)
+		_, err = db.GetColumn("c3")
+		must(t, err)
+
+		must(t, db.DeleteColumn("c3", "", []string{"listed", "unlisted"}))
+		_, err = db.GetCard("listed")
+		assertEqual(t, "deleted card", sql.ErrNoRows, err)
+		_, err = db.GetColumn("c3")
+		assertEqual(t, "deleted column", sql.ErrNoRows, err)
+	}},
+
+	{"cards", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice", "bob")
+		must(t, db.AddCard(Card{Id: "a", Column: "r1-column"}))
+		must(t, db.AddContent(Content{Id: "a1", Card: "a", Text: "hello", Author: "alice"}))
+		must(t, db.AddCard(Card{Id: "b", Column: "r1-column"}))
+		must(t, db.AddContent(Content{Id: "b1", Card: "b", Text: "world", Author: "bob"}))
+
+		must(t, db.RevealCard("a"))
+		must(t, db.UpdateContent("a1", "hi"))
+		must(t, db.Vote("bob", "b"))
+
+		must(t, db.GroupCards("b", "a"))
+		count, err := db.CountCards("r1-column")
+		must(t, err)
+		assertEqual(t, "cards after grouping", 1, count)
+
+		state, err := db.GetCardState("a")
+		must(t, err)
+		assertEqual(t, "revealed", true, state.Card.Revealed)
+		assertEqual(t, "contents", 2, len(state.Contents))
+		assertEqual(t, "votes", 1, state.Card.TotalVotes)
+
+		must(t, db.UngroupCard(Ungroup{
+			CardFrom: "a",
+			CardTo:   Card{Id: "c", Column: "r1-column"},
+			Contents: []string{"b1"},
+			Votes:    []int64{state.Votes[0].Id},
+		}))
+
+		cards, err := db.GetCards("bob", "r1-column")
+		must(t, err)
+		votes := map[string]int{}
+		for _, card := range cards {
+			votes[card.Id] = card.Votes
+		}
+		assertEqual(t, "bob's votes", map[string]int{"a": 0, "c": 1}, votes)
+
+		must(t, db.DeleteCard("c"))
+		if _, err := db.GetCard("c"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for deleted card, was %v", err)
+		}
+		content, err := db.GetContent("a1")
+		must(t, err)
+		assertEqual(t, "content", "hi", content.Text)
+	}},
+
+	{"votes", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		must(t, db.AddCard(Card{Id: "a", Column: "r1-column"}))
+		must(t, db.AddCard(Card{Id: "b", Column: "r1-column"}))
+		must(t, db.SetVoteBudget("r1", VoteBudget{PerUser: 3, PerCard: 2}))
+
+		budget, err := db.GetVoteBudget("r1")
+		must(t, err)
+		assertEqual(t, "budget", VoteBudget{PerUser: 3, PerCard: 2}, budget)
+
+		must(t, db.VoteWithinBudget("r1", "alice", "a"))
+		must(t, db.VoteWithinBudget("r1", "alice", "a"))
+		assertEqual(t, "card limit", ErrCardVoteLimit, db.VoteWithinBudget("r1", "alice", "a"))
+		must(t, db.VoteWithinBudget("r1", "alice", "b"))
+		assertEqual(t, "user limit", ErrNoVotesLeft, db.VoteWithinBudget("r1", "alice", "b"))
+
+		must(t, db.Unvote("alice", "a"))
+		count, err := db.CountVotes("r1", "alice")
+		must(t, err)
+		assertEqual(t, "votes", 2, count)
+	}},
+
+	{"undo within vote budget", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		must(t, db.AddCard(Card{Id: "a", Column: "r1-column"}))
+		must(t, db.AddCard(Card{Id: "b", Column: "r1-column"}))
+		must(t, db.SetVoteBudget("r1", VoteBudget{PerUser: 2}))
+
+		undo := func(revision Revision) {
+			revision.Retro = "r1"
+			revision.Author = "alice"
+			revision.CreatedAt = time.Now()
+			must(t, db.AddRevision(revision))
+			last, err := db.GetLastRevision("r1", "alice")
+			must(t, err)
+			must(t, db.UndoRevision(last))
+		}
+		votesOn := func(cardId string) int {
+			card, err := db.GetCard(cardId)
+			must(t, err)
+			cards, err := db.GetCards("alice", card.Column)
+			must(t, err)
+			for _, card := range cards {
+				if card.Id == cardId {
+					return card.Votes
+				}
+			}
+			return 0
+		}
+
+		// votes put back on a deleted card after they were used elsewhere
+		must(t, db.VoteWithinBudget("r1", "alice", "a"))
+		must(t, db.VoteWithinBudget("r1", "alice", "a"))
+		deleted, err := db.GetCardState("a")
+		must(t, err)
+		must(t, db.DeleteCard("a"))
+		must(t, db.VoteWithinBudget("r1", "alice", "b"))
+
+		undo(Revision{Kind: RevisionDelete, Card: "a", Before: &deleted})
+		count, err := db.CountVotes("r1", "alice")
+		must(t, err)
+		assertEqual(t, "votes after undoing delete", 2, count)
+		assertEqual(t, "votes on restored card", 1, votesOn("a"))
+
+		// votes merged back on to a card by undoing an ungroup
+		must(t, db.SetVoteBudget("r1", VoteBudget{PerCard: 1}))
+		must(t, db.AddContent(Content{Id: "b1", Card: "b", Text: "one", Author: "alice"}))
+		must(t, db.AddContent(Content{Id: "b2", Card: "b", Text: "two", Author: "alice"}))
+		grouped, err := db.GetCardState("b")
+		must(t, err)
+		must(t, db.UngroupCard(Ungroup{
+			CardFrom: "b",
+			CardTo:   Card{Id: "c", Column: "r1-column"},
+			Contents: []string{"b2"},
+			Votes:    []int64{grouped.Votes[0].Id},
+		}))
+		must(t, db.VoteWithinBudget("r1", "alice", "b"))
+
+		undo(Revision{Kind: RevisionUngroup, Card: "c", CardFrom: "b", Before: &grouped})
+		assertEqual(t, "votes after undoing ungroup", 1, votesOn("b"))
+	}},
+
+	{"concurrent votes", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		must(t, db.AddCard(Card{Id: "a", Column: "r1-column"}))
+		must(t, db.AddCard(Card{Id: "b", Column: "r1-column"}))
+		must(t, db.SetVoteBudget("r1", VoteBudget{PerUser: 3, PerCard: 2}))
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < cap(errs); i++ {
+			cardId := []string{"a", "b"}[i%2]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- db.VoteWithinBudget("r1", "alice", cardId)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		// SQLite may refuse some of the votes as the table is locked, but however
+		// many are added the budget must not be exceeded.
+		added := 0
+		for err := range errs {
+			if err == nil {
+				added++
+			}
+		}
+
+		count, err := db.CountVotes("r1", "alice")
+		must(t, err)
+		assertEqual(t, "votes", added, count)
+		if count > 3 {
+			t.Errorf("expected at most 3 votes, was %d", count)
+		}
+	}},
+
+	{"actions", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		addTestRetro(t, db, "r2", "alice")
+		must(t, db.AddAction(Action{Id: "a", Retro: "r1", Text: "do it", Status: ActionOpen}))
+		must(t, db.AddAction(Action{Id: "b", Retro: "r1", Text: "done it", Status: ActionOpen}))
+
+		due := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+		must(t, db.AssignAction("a", "alice", &due))
+		must(t, db.SetActionStatus("b", ActionDone))
+		must(t, db.CarryActions("r1", "r2"))
+
+		ok, err := db.IsActionInRetro("a", "r2")
+		must(t, err)
+		assertEqual(t, "open action carried", true, ok)
+		ok, err = db.IsActionInRetro("b", "r2")
+		must(t, err)
+		assertEqual(t, "done action carried", false, ok)
+
+		action, err := db.GetAction("a")
+		must(t, err)
+		assertEqual(t, "owner", "alice", action.Owner)
+		if action.Due == nil || !action.Due.Equal(due) {
+			t.Errorf("due: expected %v, was %v", due, action.Due)
+		}
+
+		actions, err := db.GetActions("r1")
+		must(t, err)
+		assertEqual(t, "actions", 2, len(actions))
+	}},
+
+	{"shares", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		now := time.Now().Truncate(time.Second)
+		must(t, db.AddShare(Share{Id: "s", Retro: "r1", TokenHash: "hash", CreatedBy: "alice", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+		share, err := db.GetShareByToken("hash")
+		must(t, err)
+		assertEqual(t, "retro", "r1", share.Retro)
+		assertEqual(t, "expires at", true, share.ExpiresAt.Equal(now.Add(time.Hour)))
+
+		share, err = db.RevokeShare("r1", "s")
+		must(t, err)
+		assertEqual(t, "revoked", true, share.Revoked)
+
+		shares, err := db.GetShares("r1")
+		must(t, err)
+		assertEqual(t, "shares", 1, len(shares))
+	}},
+
+	{"timers", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		addTestRetro(t, db, "r2", "alice")
+		deadline := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+		must(t, db.SetTimer(Timer{Retro: "r1", Deadline: deadline, Advance: true}))
+		must(t, db.SetTimer(Timer{Retro: "r2", Remaining: time.Minute, Paused: true}))
+
+		timer, err := db.GetTimer("r1")
+		must(t, err)
+		assertEqual(t, "deadline", true, timer.Deadline.Equal(deadline))
+		assertEqual(t, "advance", true, timer.Advance)
+
+		timers, err := db.GetRunningTimers()
+		must(t, err)
+		assertEqual(t, "running timers", 1, len(timers))
+
+		must(t, db.SetTimer(Timer{Retro: "r1", Remaining: time.Second, Paused: true}))
+		timers, err = db.GetRunningTimers()
+		must(t, err)
+		assertEqual(t, "running timers after pause", 0, len(timers))
+
+		must(t, db.DeleteTimer("r2"))
+		if _, err := db.GetTimer("r2"); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows for deleted timer, was %v", err)
+		}
+	}},
+
+	{"groups", func(t *testing.T, db Storage) {
+		addTestRetro(t, db, "r1", "alice")
+		must(t, db.EnsureUser("bob", "secret"))
+		must(t, db.SetMemberships("bob", []string{"org", "org/team"}))
+		must(t, db.SetMemberships("bob", []string{"org/team"}))
+
+		groups, err := db.GetMemberships("bob")
+		must(t, err)
+		assertEqual(t, "memberships", []string{"org/team"}, groups)
+
+		must(t, db.AddRetroGroup("r1", "org/team"))
+		must(t, db.AddRetroGroup("r1", "org/team"))
+		ok, err := db.InRetroGroup("r1", "bob")
+		must(t, err)
+		assertEqual(t, "in retro group", true, ok)
+
+		retros, err := db.GetRetros("bob")
+		must(t, err)
+		assertEqual(t, "shared retros", 1, len(retros))
+
+		must(t, db.DeleteRetroGroup("r1", "org/team"))
+		groups, err = db.GetRetroGroups("r1")
+		must(t, err)
+		assertEqual(t, "retro groups", 0, len(groups))
+	}},
+
+	{"templates", func(t *testing.T, db Storage) {
+		must(t, db.SetTemplate(Template{Id: "t", Name: "First", Columns: []string{"A", "B"}}))
+		must(t, db.SetTemplate(Template{Id: "t", Name: "Second", Columns: []string{"C"}}))
+
+		template, err := db.GetTemplate("t")
+		must(t, err)
+		assertEqual(t, "template", Template{Id: "t", Name: "Second", Columns: []string{"C"}}, template)
+
+		templates, err := db.GetTemplates()
+		must(t, err)
+		assertEqual(t, "templates", 1, len(templates))
+	}},
+
+	{"import and export", func(t *testing.T, db Storage) {
+		must(t, db.EnsureUser("alice", "a"))
+		must(t, db.EnsureUser("bob", "b"))
+
+		retro := RetroExport{
+			Id:           "r1",
+			Name:         "Imported",
+			Stage:        "Done",
+			CreatedAt:    time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+			Participants: []string{"alice", "bob"},
+			Roles:        map[string]string{"alice": RoleOwner},
+			VoteBudget:   VoteBudgetExport{PerUser: 3},
+			Columns: []ColumnExport{{
+				Id:   "c1",
+				Name: "Start",
+				Cards: []CardExport{{
+					Id:         "a",
+					Revealed:   true,
+					TotalVotes: 4,
+					Votes:      map[string]int{"alice": 1, "bob": 1, "": 2},
+					Contents: []ContentExport{
+						{Id: "a1", Text: "hello", Author: "bob"},
+						{Id: "a2", Text: "hi", Author: ""},
+					},
+				}},
+			}},
+			Actions: []ActionExport{{Id: "x", Card: "a", Text: "do it", Owner: "bob", Status: ActionOpen}},
+		}
+		must(t, db.ImportRetro(retro))
+
+		if _, err := db.GetUser(""); err != sql.ErrNoRows {
+			t.Errorf("expected no user to be created for empty authors, was %v", err)
+		}
+
+		exported, err := db.ExportRetro("r1")
+		must(t, err)
+		assertEqual(t, "created at", true, exported.CreatedAt.Equal(retro.CreatedAt))
+		exported.CreatedAt = retro.CreatedAt
+		sort.Strings(exported.Participants)
+		assertEqual(t, "export", retro, exported)
+	}},
+}
+
+func TestStorage(t *testing.T) {
+	for backend, open := range testBackends(t) {
+		for _, tc := range storageTests {
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				db := open(t)
+				defer db.Close()
+
+				tc.test(t, db)
+			})
+		}
+	}
+}
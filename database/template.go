@@ -0,0 +1,108 @@
+package database
+
+type Template struct {
+	Id      string
+	Name    string
+	Columns []string
+}
+
+// SetTemplate adds the template, or replaces the existing template with the
+// same Id.
+func (d *Database) SetTemplate(template Template) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(d.dialect.upsert("templates", []string{"Id"}, "Name"),
+		template.Id,
+		template.Name)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM template_columns WHERE Template=?",
+		template.Id)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i, name := range template.Columns {
+		_, err = tx.Exec("INSERT INTO template_columns(Template, Name, \"Order\") VALUES (?, ?, ?)",
+			template.Id,
+			name,
+			i)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) GetTemplate(id string) (Template, error) {
+	row := d.db.QueryRow("SELECT Id, Name FROM templates WHERE Id=?",
+		id)
+
+	var template Template
+	if err := row.Scan(&template.Id, &template.Name); err != nil {
+		return template, err
+	}
+
+	columns, err := d.getTemplateColumns(id)
+	template.Columns = columns
+
+	return template, err
+}
+
+func (d *Database) GetTemplates() (templates []Template, err error) {
+	rows, err := d.db.Query("SELECT Id, Name FROM templates ORDER BY Name")
+	if err != nil {
+		return templates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var template Template
+		if err = rows.Scan(&template.Id, &template.Name); err != nil {
+			return templates, err
+		}
+		templates = append(templates, template)
+	}
+	if err = rows.Err(); err != nil {
+		return templates, err
+	}
+
+	for i, template := range templates {
+		if templates[i].Columns, err = d.getTemplateColumns(template.Id); err != nil {
+			return templates, err
+		}
+	}
+
+	return templates, nil
+}
+
+func (d *Database) getTemplateColumns(templateId string) (columns []string, err error) {
+	rows, err := d.db.Query("SELECT Name FROM template_columns WHERE Template=? ORDER BY \"Order\"",
+		templateId)
+	if err != nil {
+		return columns, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return columns, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
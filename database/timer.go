@@ -0,0 +1,74 @@
+package database
+
+import "time"
+
+// A Timer counts down to a deadline for a retro. When Paused the deadline is
+// not used, and Remaining is the time that was left when it was paused. The
+// deadline is stored to the millisecond.
+type Timer struct {
+	Retro     string
+	Deadline  time.Time
+	Remaining time.Duration
+	Paused    bool
+
+	// Advance moves the retro to its next stage when the timer expires.
+	Advance bool
+}
+
+// SetTimer starts, or replaces, the timer for the retro.
+func (d *Database) SetTimer(timer Timer) error {
+	_, err := d.db.Exec(d.dialect.upsert("timers", []string{"Retro"}, "Deadline", "Remaining", "Paused", "Advance"),
+		timer.Retro,
+		timer.Deadline.UnixNano()/int64(time.Millisecond),
+		int64(timer.Remaining/time.Millisecond),
+		timer.Paused,
+		timer.Advance)
+
+	return err
+}
+
+// GetTimer returns the retro's timer, or sql.ErrNoRows if it does not have one.
+func (d *Database) GetTimer(retroId string) (Timer, error) {
+	row := d.db.QueryRow("SELECT Retro, Deadline, Remaining, Paused, Advance FROM timers WHERE Retro = ?",
+		retroId)
+
+	return scanTimer(row)
+}
+
+func (d *Database) DeleteTimer(retroId string) error {
+	_, err := d.db.Exec("DELETE FROM timers WHERE Retro = ?",
+		retroId)
+
+	return err
+}
+
+// GetRunningTimers returns every timer that is not paused.
+func (d *Database) GetRunningTimers() (timers []Timer, err error) {
+	rows, err := d.db.Query("SELECT Retro, Deadline, Remaining, Paused, Advance FROM timers WHERE Paused = ?",
+		false)
+	if err != nil {
+		return timers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		timer, err := scanTimer(rows)
+		if err != nil {
+			return timers, err
+		}
+		timers = append(timers, timer)
+	}
+
+	return timers, rows.Err()
+}
+
+func scanTimer(row scanner) (Timer, error) {
+	var timer Timer
+	var deadline, remaining int64
+
+	err := row.Scan(&timer.Retro, &deadline, &remaining, &timer.Paused, &timer.Advance)
+	timer.Deadline = time.Unix(0, deadline*int64(time.Millisecond))
+	timer.Remaining = time.Duration(remaining) * time.Millisecond
+
+	return timer, err
+}
@@ -6,13 +6,23 @@ type User struct {
 }
 
 func (d *Database) EnsureUser(username, secret string) error {
-	_, err := d.db.Exec("INSERT OR IGNORE INTO users(Username, Secret) VALUES(?, ?)",
+	_, err := d.db.Exec(d.dialect.insertOrIgnore("users", "Username", "Secret"),
 		username,
 		secret)
 
 	return err
 }
 
+// SetSecret changes the secret that the user's access tokens are signed with, so
+// that any tokens already issued stop working.
+func (d *Database) SetSecret(username, secret string) error {
+	_, err := d.db.Exec("UPDATE users SET Secret = ? WHERE Username = ?",
+		secret,
+		username)
+
+	return err
+}
+
 func (d *Database) GetUser(username string) (User, error) {
 	row := d.db.QueryRow("SELECT Username, Secret FROM users WHERE Username=?",
 		username)
@@ -1,11 +1,33 @@
 package database
 
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrNoVotesLeft is returned when a user has used all of their votes in a
+	// retro.
+	ErrNoVotesLeft = errors.New("no votes left")
+
+	// ErrCardVoteLimit is returned when a user has put as many votes on a card as
+	// is allowed.
+	ErrCardVoteLimit = errors.New("card vote limit reached")
+)
+
 type Vote struct {
 	Username string
 	Card     string
 	Count    int
 }
 
+// VoteBudget limits how many votes each participant of a retro has. A limit of
+// zero means there is no limit.
+type VoteBudget struct {
+	PerUser int
+	PerCard int
+}
+
 func (d *Database) Vote(username, cardId string) error {
 	_, err := d.db.Exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
 		username, cardId)
@@ -13,9 +35,181 @@ func (d *Database) Vote(username, cardId string) error {
 	return err
 }
 
+// VoteWithinBudget adds a vote by username to the card, as long as it would not
+// go over the retro's budget.
+func (d *Database) VoteWithinBudget(retroId, username, cardId string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Updating the participant locks it until the transaction ends, so that
+	// votes by the same user are counted one at a time and cannot each see the
+	// budget before the other has been added.
+	_, err = tx.Exec("UPDATE participants SET Role = Role WHERE Retro=? AND Username=?",
+		retroId, username)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	budget, err := getVoteBudget(tx, retroId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if budget.PerUser > 0 {
+		used, err := countVotes(tx, retroId, username)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if used >= budget.PerUser {
+			tx.Rollback()
+			return ErrNoVotesLeft
+		}
+	}
+
+	if budget.PerCard > 0 {
+		var onCard int
+		err := tx.QueryRow("SELECT COUNT(*) FROM votes WHERE Username=? AND Card=?",
+			username, cardId).Scan(&onCard)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if onCard >= budget.PerCard {
+			tx.Rollback()
+			return ErrCardVoteLimit
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
+		username, cardId)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (d *Database) Unvote(username, cardId string) error {
 	_, err := d.db.Exec("DELETE FROM votes WHERE Id=(SELECT MIN(Id) FROM votes WHERE Username=? AND Card=?)",
 		username, cardId)
 
 	return err
 }
+
+// dropVotesOverBudget removes the newest votes on the card that take a user over
+// the retro's vote budget, such as votes that an undo puts back after the user
+// has used them on other cards.
+func dropVotesOverBudget(db *tx, retroId, cardId string) error {
+	budget, err := getVoteBudget(db, retroId)
+	if err != nil || (budget.PerUser == 0 && budget.PerCard == 0) {
+		return err
+	}
+
+	// Lock the participants, as VoteWithinBudget does, so that votes are not
+	// counted while others are being added.
+	if _, err = db.Exec("UPDATE participants SET Role = Role WHERE Retro=?", retroId); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT Id, Username FROM votes WHERE Card=? AND Username IS NOT NULL ORDER BY Id",
+		cardId)
+	if err != nil {
+		return err
+	}
+
+	var votes []CardVote
+	onCard := map[string]int{}
+	for rows.Next() {
+		var vote CardVote
+		if err = rows.Scan(&vote.Id, &vote.Username); err != nil {
+			rows.Close()
+			return err
+		}
+		votes = append(votes, vote)
+		onCard[vote.Username]++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := len(votes) - 1; i >= 0; i-- {
+		vote := votes[i]
+
+		over := budget.PerCard > 0 && onCard[vote.Username] > budget.PerCard
+		if !over && budget.PerUser > 0 {
+			used, err := countVotes(db, retroId, vote.Username)
+			if err != nil {
+				return err
+			}
+			over = used > budget.PerUser
+		}
+
+		if over {
+			if _, err = db.Exec("DELETE FROM votes WHERE Id=?", vote.Id); err != nil {
+				return err
+			}
+			onCard[vote.Username]--
+		}
+	}
+
+	return nil
+}
+
+// CountVotes returns the number of votes username has used in the retro.
+func (d *Database) CountVotes(retroId, username string) (int, error) {
+	return countVotes(d.db, retroId, username)
+}
+
+func (d *Database) SetVoteBudget(retroId string, budget VoteBudget) error {
+	_, err := d.db.Exec(d.dialect.upsert("vote_budgets", []string{"Retro"}, "PerUser", "PerCard"),
+		retroId,
+		budget.PerUser,
+		budget.PerCard)
+
+	return err
+}
+
+func (d *Database) GetVoteBudget(retroId string) (VoteBudget, error) {
+	return getVoteBudget(d.db, retroId)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func getVoteBudget(db queryRower, retroId string) (VoteBudget, error) {
+	row := db.QueryRow("SELECT PerUser, PerCard FROM vote_budgets WHERE Retro=?",
+		retroId)
+
+	var budget VoteBudget
+	err := row.Scan(&budget.PerUser, &budget.PerCard)
+	if err == sql.ErrNoRows {
+		return budget, nil
+	}
+
+	return budget, err
+}
+
+func countVotes(db queryRower, retroId, username string) (int, error) {
+	row := db.QueryRow(`
+    SELECT COUNT(votes.Id)
+    FROM votes
+    INNER JOIN cards ON votes.Card = cards.Id
+    INNER JOIN columns ON cards."Column" = columns.Id
+    WHERE columns.Retro = ? AND votes.Username = ?`,
+		retroId,
+		username)
+
+	var count int
+	err := row.Scan(&count)
+
+	return count, err
+}
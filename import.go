@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/room"
+)
+
+// runImport handles the "import" subcommand, which adds a retro from a file in
+// the JSON export format. Only names in the file that are, or are mapped to,
+// existing users are kept.
+func runImport(db database.Storage, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	usersPath := flags.String("users", "", "JSON file mapping usernames in the retro to local usernames")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: retro [options] import [-users PATH] FILE")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	usernames := map[string]string{}
+	if *usersPath != "" {
+		file, err := os.Open(*usersPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := json.NewDecoder(file).Decode(&usernames); err != nil {
+			return fmt.Errorf("could not read users: %v", err)
+		}
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	export, err := room.DecodeImport(file)
+	if err != nil {
+		return err
+	}
+
+	// whoever can run retro can say who the retro's users are, but users are
+	// not created for names that are not already users
+	retroId, err := room.Import(db, export, usernames, func(username string) bool {
+		_, err := db.GetUser(username)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(retroId)
+	return nil
+}
@@ -39,14 +39,50 @@ func main() {
 	}
 	defer db.Close()
 
+	loadTemplates := func() error {
+		for _, template := range conf.Templates {
+			err := db.SetTemplate(database.Template{
+				Id:      template.Id,
+				Name:    template.Name,
+				Columns: template.Columns,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := loadTemplates(); err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.Arg(0) == "import" {
+		if err := runImport(db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var oidcName string
+	if conf.OIDC != nil {
+		oidcName = conf.OIDC.Name
+	}
+
 	room := room.New(room.Config{
 		HasGitHub:    conf.GitHub != nil,
 		HasOffice365: conf.Office365 != nil,
 		HasTest:      *test,
+		OIDCName:     oidcName,
+
+		DefaultTemplate: config.DefaultTemplate.Id,
 	}, db)
 
 	http.Handle("/", http.FileServer(http.Dir(*assets)))
 	http.Handle("/ws", room.Server)
+	http.HandleFunc("/export", room.Export)
+	http.HandleFunc("/import", room.ImportHandler)
+	http.HandleFunc("/refresh", room.RefreshHandler)
 
 	if *test {
 		testLogin, testCallback := auth.Test(room.AuthCallback)
@@ -57,6 +93,9 @@ func main() {
 			if err := db.Reset(); err != nil {
 				log.Fatal(err)
 			}
+			if err := loadTemplates(); err != nil {
+				log.Fatal(err)
+			}
 
 			http.Redirect(w, r, "/", http.StatusFound)
 		})
@@ -67,7 +106,8 @@ func main() {
 			room.AuthCallback,
 			conf.GitHub.ClientID,
 			conf.GitHub.ClientSecret,
-			conf.GitHub.Organisation)
+			conf.GitHub.Organisations,
+			conf.GitHub.Teams)
 		http.Handle("/oauth/github/login", gitHubLogin)
 		http.Handle("/oauth/github/callback", gitHubCallback)
 	}
@@ -82,5 +122,20 @@ func main() {
 		http.Handle("/oauth/office365/callback", officeCallback)
 	}
 
+	if conf.OIDC != nil {
+		oidcLogin, oidcCallback := auth.OIDC(room.AuthCallback, auth.OIDCConfig{
+			DiscoveryURL: conf.OIDC.DiscoveryURL,
+			ClientID:     conf.OIDC.ClientID,
+			ClientSecret: conf.OIDC.ClientSecret,
+			RedirectURL:  conf.OIDC.RedirectURL,
+			Scopes:       conf.OIDC.Scopes,
+			Domains:      conf.OIDC.Domains,
+			GroupsClaim:  conf.OIDC.GroupsClaim,
+			Groups:       conf.OIDC.Groups,
+		})
+		http.Handle("/oauth/oidc/login", oidcLogin)
+		http.Handle("/oauth/oidc/callback", oidcCallback)
+	}
+
 	serve.Serve(*port, *socket, http.DefaultServeMux)
 }
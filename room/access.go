@@ -0,0 +1,235 @@
+package room
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// targets contains every field that a message can use to refer to something in
+// a retro. Messages only set the fields they need, so decoding any message's
+// data in to it gives the things that message will change.
+type targets struct {
+	RetroId    string `json:"retroId"`
+	ColumnId   string `json:"columnId"`
+	ColumnFrom string `json:"columnFrom"`
+	ColumnTo   string `json:"columnTo"`
+	CardId     string `json:"cardId"`
+	CardFrom   string `json:"cardFrom"`
+	CardTo     string `json:"cardTo"`
+	ContentId  string `json:"contentId"`
+	ActionId   string `json:"actionId"`
+}
+
+// participant wraps a handler so that it is only called when the connection's
+// user is a participant of the retro that the message refers to, with a role
+// that allows the op.
+func (r *Room) participant(op string, handler sock.Handler) sock.Handler {
+	return r.guard(op, false, handler)
+}
+
+// inRetro wraps a handler so that it is only called when the message refers to
+// the retro the connection has joined, the connection's user is a participant of
+// that retro with a role that allows the op, and the op is allowed in the
+// retro's current stage.
+func (r *Room) inRetro(op string, handler sock.Handler) sock.Handler {
+	return r.guard(op, true, handler)
+}
+
+// signedIn wraps a handler so that it is only called for connections made by a
+// user, rather than with a share token.
+func (r *Room) signedIn(op string, handler sock.Handler) sock.Handler {
+	return func(conn *sock.Conn, data []byte) {
+		if conn.Share != "" {
+			sendError(conn, op, errForbidden)
+			return
+		}
+
+		handler(conn, data)
+	}
+}
+
+func (r *Room) guard(op string, mustBeJoined bool, handler sock.Handler) sock.Handler {
+	return func(conn *sock.Conn, data []byte) {
+		retroId, err := r.targetRetro(conn, data)
+		if err == nil && mustBeJoined && retroId != conn.RetroId {
+			err = errNotInRetro
+		}
+		if err == nil && conn.Share != "" {
+			err = r.checkShare(conn.Share, retroId, requiredRole(op))
+		} else if err == nil {
+			err = r.checkRole(retroId, conn.Name, requiredRole(op))
+		}
+		if err == nil && mustBeJoined {
+			err = r.checkStage(op, retroId)
+		}
+
+		if err != nil {
+			sendError(conn, op, err)
+			return
+		}
+
+		handler(conn, data)
+	}
+}
+
+func (r *Room) checkParticipant(retroId, username string) error {
+	ok, err := r.db.IsParticipant(retroId, username)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errForbidden
+	}
+
+	return nil
+}
+
+// checkFacilitator makes sure that username is a facilitator, or the owner, of
+// the retro.
+func (r *Room) checkFacilitator(retroId, username string) error {
+	return r.checkRole(retroId, username, database.RoleFacilitator)
+}
+
+func (r *Room) checkStage(op, retroId string) error {
+	if _, ok := stageRules[op]; !ok {
+		return nil
+	}
+
+	retro, err := r.db.GetRetro(retroId)
+	if err != nil {
+		return err
+	}
+	if !allowedInStage(op, retro.Stage) {
+		return errWrongStage
+	}
+
+	return nil
+}
+
+// targetRetro finds the single retro that data refers to. If data does not
+// refer to anything the retro the connection has joined is used.
+func (r *Room) targetRetro(conn *sock.Conn, data []byte) (string, error) {
+	var args targets
+	if err := json.Unmarshal(data, &args); err != nil {
+		return "", err
+	}
+
+	var retroIds []string
+
+	if args.RetroId != "" {
+		if _, err := r.db.GetRetro(args.RetroId); err != nil {
+			return "", notFound(err)
+		}
+		retroIds = append(retroIds, args.RetroId)
+	}
+
+	for _, columnId := range []string{args.ColumnId, args.ColumnFrom, args.ColumnTo} {
+		if columnId == "" {
+			continue
+		}
+
+		retroId, err := r.retroForColumn(columnId)
+		if err != nil {
+			return "", err
+		}
+		retroIds = append(retroIds, retroId)
+	}
+
+	for _, cardId := range []string{args.CardId, args.CardFrom, args.CardTo} {
+		if cardId == "" {
+			continue
+		}
+
+		retroId, err := r.retroForCard(cardId)
+		if err != nil {
+			return "", err
+		}
+		retroIds = append(retroIds, retroId)
+	}
+
+	if args.ContentId != "" {
+		content, err := r.db.GetContent(args.ContentId)
+		if err != nil {
+			return "", notFound(err)
+		}
+
+		retroId, err := r.retroForCard(content.Card)
+		if err != nil {
+			return "", err
+		}
+		retroIds = append(retroIds, retroId)
+	}
+
+	if args.ActionId != "" {
+		retroId, err := r.retroForAction(conn, args.ActionId)
+		if err != nil {
+			return "", err
+		}
+		retroIds = append(retroIds, retroId)
+	}
+
+	if len(retroIds) == 0 {
+		if conn.RetroId == "" {
+			return "", errNotInRetro
+		}
+		return conn.RetroId, nil
+	}
+
+	for _, retroId := range retroIds[1:] {
+		if retroId != retroIds[0] {
+			return "", errMixedRetros
+		}
+	}
+
+	return retroIds[0], nil
+}
+
+func (r *Room) retroForColumn(columnId string) (string, error) {
+	column, err := r.db.GetColumn(columnId)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return column.Retro, nil
+}
+
+func (r *Room) retroForCard(cardId string) (string, error) {
+	card, err := r.db.GetCard(cardId)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return r.retroForColumn(card.Column)
+}
+
+// retroForAction gives the retro the connection has joined if the action is
+// listed there, otherwise the retro the action was added in.
+func (r *Room) retroForAction(conn *sock.Conn, actionId string) (string, error) {
+	if conn.RetroId != "" {
+		ok, err := r.db.IsActionInRetro(actionId, conn.RetroId)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return conn.RetroId, nil
+		}
+	}
+
+	action, err := r.db.GetAction(actionId)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return action.Retro, nil
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+
+	return err
+}
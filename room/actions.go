@@ -0,0 +1,174 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+func registerActionHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("addAction", r.inRetro("addAction", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			CardId string     `json:"cardId"`
+			Text   string     `json:"text"`
+			Owner  string     `json:"owner"`
+			Due    *time.Time `json:"due"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("addAction:", err)
+			return
+		}
+
+		if err := r.checkOwner(args.Owner); err != nil {
+			sendError(conn, "addAction", err)
+			return
+		}
+
+		action := database.Action{
+			Id:     strId(),
+			Retro:  conn.RetroId,
+			Card:   args.CardId,
+			Text:   args.Text,
+			Owner:  args.Owner,
+			Due:    args.Due,
+			Status: database.ActionOpen,
+		}
+
+		if err := r.db.AddAction(action); err != nil {
+			log.Println("addAction db:", err)
+			return
+		}
+
+		conn.Broadcast(conn.Name, "action", newActionData(action))
+	}))
+
+	mux.Handle("assignAction", r.inRetro("assignAction", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			ActionId string     `json:"actionId"`
+			Owner    string     `json:"owner"`
+			Due      *time.Time `json:"due"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("assignAction:", err)
+			return
+		}
+
+		if err := r.checkOwner(args.Owner); err != nil {
+			sendError(conn, "assignAction", err)
+			return
+		}
+
+		if err := r.db.AssignAction(args.ActionId, args.Owner, args.Due); err != nil {
+			log.Println("assignAction db:", err)
+			return
+		}
+
+		r.broadcastAction(conn, args.ActionId)
+	}))
+
+	mux.Handle("completeAction", r.inRetro("completeAction", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			ActionId string `json:"actionId"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("completeAction:", err)
+			return
+		}
+
+		if err := r.db.SetActionStatus(args.ActionId, database.ActionDone); err != nil {
+			log.Println("completeAction db:", err)
+			return
+		}
+
+		r.broadcastAction(conn, args.ActionId)
+	}))
+}
+
+func (r *Room) broadcastAction(conn *sock.Conn, actionId string) {
+	action, err := r.db.GetAction(actionId)
+	if err != nil {
+		log.Println("action", actionId, err)
+		return
+	}
+
+	conn.Broadcast(conn.Name, "action", newActionData(action))
+}
+
+// checkOwner makes sure that an action is being assigned to a known user, or to
+// no one.
+func (r *Room) checkOwner(owner string) error {
+	if owner == "" {
+		return nil
+	}
+
+	_, err := r.db.GetUser(owner)
+	return notFound(err)
+}
+
+// carryActions finds the last retro that had the same participants as retroId,
+// and carries its unfinished actions over.
+func (r *Room) carryActions(retroId string, participants []string) error {
+	retros, err := r.db.GetRetros(participants[0])
+	if err != nil {
+		return err
+	}
+
+	for i := len(retros) - 1; i >= 0; i-- {
+		if retros[i].Id == retroId {
+			continue
+		}
+
+		previous, err := r.db.GetParticipants(retros[i].Id)
+		if err != nil {
+			return err
+		}
+
+		if sameUsers(participants, previous) {
+			return r.db.CarryActions(retros[i].Id, retroId)
+		}
+	}
+
+	return nil
+}
+
+func sameUsers(a, b []string) bool {
+	set := map[string]bool{}
+	for _, user := range a {
+		set[user] = true
+	}
+
+	other := map[string]bool{}
+	for _, user := range b {
+		if !set[user] {
+			return false
+		}
+		other[user] = true
+	}
+
+	return len(set) == len(other)
+}
+
+type actionData struct {
+	ActionId string     `json:"actionId"`
+	RetroId  string     `json:"retroId"`
+	CardId   string     `json:"cardId"`
+	Text     string     `json:"text"`
+	Owner    string     `json:"owner"`
+	Due      *time.Time `json:"due"`
+	Status   string     `json:"status"`
+}
+
+func newActionData(action database.Action) actionData {
+	return actionData{
+		ActionId: action.Id,
+		RetroId:  action.Retro,
+		CardId:   action.Card,
+		Text:     action.Text,
+		Owner:    action.Owner,
+		Due:      action.Due,
+		Status:   action.Status,
+	}
+}
@@ -0,0 +1,57 @@
+package room
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestOpenActionsCarryOverToNextRetro(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	room.connect(t, "bob")
+
+	alice.createRetro("bob")
+	alice.rest()
+
+	var open, done actionData
+	alice.send("addAction", map[string]string{"text": "open", "owner": "bob"})
+	alice.expect("action", &open)
+	alice.send("addAction", map[string]string{"text": "done"})
+	alice.expect("action", &done)
+	alice.send("completeAction", map[string]string{"actionId": done.ActionId})
+	alice.expect("action", &done)
+	if done.Status != database.ActionDone {
+		t.Fatalf("expected action to be done, was %s", done.Status)
+	}
+
+	var failed errorData
+	alice.send("addAction", map[string]string{"text": "nobody", "owner": "mallory"})
+	alice.expect("error", &failed)
+	if failed.Error != errNotFound.Error() {
+		t.Fatalf("expected %v assigning an action to an unknown user, was %s", errNotFound, failed.Error)
+	}
+
+	retroId, _ := alice.createRetro("bob")
+
+	var carried []actionData
+	for _, msg := range alice.rest() {
+		if msg.Op == "action" {
+			var action actionData
+			if err := json.Unmarshal([]byte(msg.Data), &action); err != nil {
+				t.Fatal(err)
+			}
+			carried = append(carried, action)
+		}
+	}
+
+	if len(carried) != 1 || carried[0].ActionId != open.ActionId || carried[0].Owner != "bob" {
+		t.Fatalf("expected only the open action to be carried over, was %+v", carried)
+	}
+	if ok, err := room.db.IsActionInRetro(open.ActionId, retroId); err != nil || !ok {
+		t.Fatalf("expected the open action to be in the new retro: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+type anonymousData struct {
+	Anonymous bool `json:"anonymous"`
+}
+
+func registerAnonymityHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("setAnonymous", r.inRetro("setAnonymous", func(conn *sock.Conn, data []byte) {
+		var args anonymousData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("setAnonymous:", err)
+			return
+		}
+
+		// Turning anonymity off would show who wrote the cards already in the
+		// retro, so can only be done before any are written.
+		if err := r.db.SetAnonymous(conn.RetroId, args.Anonymous); err != nil {
+			sendError(conn, "setAnonymous", err)
+			return
+		}
+
+		conn.Broadcast(conn.Name, "anonymous", args)
+	}))
+}
+
+// isAnonymous checks whether the retro hides the authors of cards.
+func (r *Room) isAnonymous(retroId string) bool {
+	retro, err := r.db.GetRetro(retroId)
+	if err != nil {
+		log.Println("isAnonymous", retroId, err)
+		return false
+	}
+
+	return retro.Anonymous
+}
+
+// authorFor gives the author of a card as it should be shown to username.
+func authorFor(anonymous bool, author, username string) string {
+	if anonymous && author != username {
+		return ""
+	}
+
+	return author
+}
+
+// broadcastContent sends the content to everyone in the retro. The author is
+// used as the message's id, unless the retro is anonymous when only the author
+// is told. If the card is not revealed only the author is sent the text.
+func (r *Room) broadcastContent(conn *sock.Conn, revealed bool, author string, content contentData) {
+	anonymous := r.isAnonymous(conn.RetroId)
+
+	conn.BroadcastFunc("content", func(to *sock.Conn) (string, interface{}, bool) {
+		return authorFor(anonymous, author, to.Name), contentFor(revealed, author, to.Name, content), true
+	})
+}
+
+// anonymiseExport removes the authors of cards that username did not write, if
+// the retro is anonymous. Cards without an author are imported without one, so
+// no one else can be made their author.
+func anonymiseExport(export *database.RetroExport, username string) {
+	if !export.Anonymous {
+		return
+	}
+
+	for i := range export.Columns {
+		for j := range export.Columns[i].Cards {
+			contents := export.Columns[i].Cards[j].Contents
+			for k := range contents {
+				contents[k].Author = authorFor(true, contents[k].Author, username)
+			}
+		}
+	}
+}
+
+// cardActor gives the id to use for messages about changes to cards. In
+// anonymous retros it is empty, as changes are often made by the card's author.
+func (r *Room) cardActor(conn *sock.Conn) string {
+	if r.isAnonymous(conn.RetroId) {
+		return ""
+	}
+
+	return conn.Name
+}
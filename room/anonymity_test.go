@@ -0,0 +1,50 @@
+package room
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAnonymityCanOnlyBeTurnedOffWithoutCards(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	retroId, columns := alice.createRetro()
+	alice.rest()
+
+	setAnonymous := func(anonymous bool) string {
+		alice.send("setAnonymous", anonymousData{Anonymous: anonymous})
+		for _, msg := range alice.rest() {
+			switch msg.Op {
+			case "anonymous":
+				return ""
+			case "error":
+				var err errorData
+				json.Unmarshal([]byte(msg.Data), &err)
+				return err.Error
+			}
+		}
+		return "nothing sent"
+	}
+
+	if err := setAnonymous(true); err != "" {
+		t.Fatalf("expected anonymity to be turned on, was %s", err)
+	}
+	if err := setAnonymous(false); err != "" {
+		t.Fatalf("expected anonymity to be turned off without cards, was %s", err)
+	}
+	if err := setAnonymous(true); err != "" {
+		t.Fatalf("expected anonymity to be turned on again, was %s", err)
+	}
+
+	alice.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "secret"})
+	alice.expect("card")
+
+	if err := setAnonymous(false); err != errRetroNotEmpty.Error() {
+		t.Fatalf("expected %v turning anonymity off with cards, was %s", errRetroNotEmpty, err)
+	}
+	if !room.isAnonymous(retroId) {
+		t.Fatal("expected retro to still be anonymous")
+	}
+}
@@ -0,0 +1,48 @@
+package room
+
+import (
+	"testing"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestDeleteColumn(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	_, columns := alice.createRetro()
+	alice.rest()
+
+	var card cardData
+	alice.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "hello"})
+	alice.expect("card", &card)
+	alice.rest()
+
+	var failed errorData
+	alice.send("deleteColumn", deleteColumnData{ColumnId: columns[0].ColumnId})
+	alice.expect("error", &failed)
+	if failed.Error != errColumnNotEmpty.Error() {
+		t.Fatalf("expected %v deleting a column with cards, was %s", errColumnNotEmpty, failed.Error)
+	}
+
+	alice.send("deleteColumn", deleteColumnData{ColumnId: columns[0].ColumnId, DeleteCards: true})
+	alice.expect("deleteColumn")
+
+	revisions, err := room.db.GetCardRevisions(card.CardId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(revisions); n == 0 || revisions[n-1].Kind != database.RevisionDelete || revisions[n-1].Before == nil {
+		t.Fatalf("expected the card's deletion to be recorded, was %v", revisions)
+	}
+
+	alice.send("undo", struct{}{})
+	alice.expect("error", &failed)
+	if failed.Error != errUndoConflict.Error() {
+		t.Fatalf("expected %v undoing into a deleted column, was %s", errUndoConflict, failed.Error)
+	}
+	if _, err := room.db.GetCard(card.CardId); err == nil {
+		t.Fatal("expected the card not to be restored")
+	}
+}
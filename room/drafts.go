@@ -0,0 +1,90 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+type revealColumnData struct {
+	ColumnId string `json:"columnId"`
+}
+
+func registerDraftHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("revealColumn", r.inRetro("revealColumn", func(conn *sock.Conn, data []byte) {
+		var args revealColumnData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("revealColumn:", err)
+			return
+		}
+
+		cards, err := r.db.GetCards(conn.Name, args.ColumnId)
+		if err != nil {
+			log.Println("revealColumn db:", err)
+			return
+		}
+
+		for _, card := range cards {
+			if card.Revealed {
+				continue
+			}
+
+			before := r.cardState(card.Id)
+
+			if err := r.db.RevealCard(card.Id); err != nil {
+				log.Println("revealColumn db:", err)
+				return
+			}
+
+			r.addRevision(conn, database.Revision{
+				Kind:   database.RevisionReveal,
+				Card:   card.Id,
+				Before: before,
+			})
+
+			conn.Broadcast(r.cardActor(conn), "reveal", revealData{args.ColumnId, card.Id})
+			r.broadcastContents(conn, card.Id)
+		}
+	}))
+}
+
+// contentFor gives the content as it should be shown to username. Until the
+// card is revealed only its author is shown the text.
+func contentFor(revealed bool, author, username string, content contentData) contentData {
+	content.Hidden = !revealed && author != username
+	if content.Hidden {
+		content.CardText = ""
+	}
+
+	return content
+}
+
+// hideDrafts removes the contents of cards that have not been revealed, and that
+// username did not write, from the export. Cards left without any contents are
+// removed.
+func hideDrafts(export *database.RetroExport, username string) {
+	for i, column := range export.Columns {
+		var cards []database.CardExport
+
+		for _, card := range column.Cards {
+			if !card.Revealed {
+				var contents []database.ContentExport
+				for _, content := range card.Contents {
+					if content.Author == username {
+						contents = append(contents, content)
+					}
+				}
+				if len(contents) == 0 {
+					continue
+				}
+				card.Contents = contents
+			}
+
+			cards = append(cards, card)
+		}
+
+		export.Columns[i].Cards = cards
+	}
+}
@@ -0,0 +1,46 @@
+package room
+
+import "testing"
+
+func TestDraftsAreHiddenUntilRevealed(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+	carol := room.connect(t, "carol")
+
+	retroId, columns := alice.createRetro("bob", "carol")
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	carol.send("joinRetro", map[string]string{"retroId": retroId})
+	alice.rest()
+	bob.rest()
+	carol.rest()
+
+	var content contentData
+	bob.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "secret"})
+	bob.expect("content", &content)
+	if content.Hidden || content.CardText != "secret" {
+		t.Fatalf("expected bob to be shown their own card, was %+v", content)
+	}
+	alice.expect("content", &content)
+	if !content.Hidden || content.CardText != "" {
+		t.Fatalf("expected alice not to be shown bob's draft, was %+v", content)
+	}
+	carol.rest()
+
+	var failed errorData
+	carol.send("reveal", revealData{ColumnId: columns[0].ColumnId, CardId: content.CardId})
+	carol.expect("error", &failed)
+	if failed.Op != "reveal" {
+		t.Fatalf("expected carol not to be able to reveal bob's card, was %+v", failed)
+	}
+
+	bob.send("reveal", revealData{ColumnId: columns[0].ColumnId, CardId: content.CardId})
+	alice.expect("reveal")
+	var revealed contentData
+	alice.expect("content", &revealed)
+	if revealed.Hidden || revealed.CardText != "secret" {
+		t.Fatalf("expected alice to be shown bob's card once revealed, was %+v", revealed)
+	}
+}
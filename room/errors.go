@@ -0,0 +1,73 @@
+package room
+
+import (
+	"errors"
+	"log"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// These errors are sent to clients in the "error" field of an "error" message,
+// so their text is a code that can be matched on.
+var (
+	errNotFound       = errors.New("not_found")
+	errForbidden      = errors.New("forbidden")
+	errNotInRetro     = errors.New("not_in_retro")
+	errMixedRetros    = errors.New("mixed_retros")
+	errColumnMismatch = errors.New("column_mismatch")
+	errColumnNotEmpty = errors.New("column_not_empty")
+	errBadRequest     = errors.New("bad_request")
+	errWrongStage     = errors.New("wrong_stage")
+	errBadTransition  = errors.New("bad_transition")
+	errNotFacilitator = errors.New("not_facilitator")
+	errNotOwner       = errors.New("not_owner")
+	errReadOnly       = errors.New("read_only")
+	errNoVotesLeft    = errors.New("no_votes_left")
+	errCardVoteLimit  = errors.New("card_vote_limit")
+	errNothingToUndo  = errors.New("nothing_to_undo")
+	errUndoConflict   = errors.New("undo_conflict")
+	errRetroNotEmpty  = errors.New("retro_not_empty")
+)
+
+// These errors are sent when a message, or request, is not authenticated. When
+// sent errTokenExpired the client should get a new access token with its
+// refresh token, which fails with errBadRefresh if it has been used or the
+// session has ended.
+var (
+	errBadAuth      = errors.New("bad_auth")
+	errTokenExpired = sock.ErrTokenExpired
+	errBadRefresh   = errors.New("bad_refresh")
+)
+
+// errorCode gives the code to send to a client for err, so that errors from the
+// database are not sent.
+func errorCode(err error) string {
+	switch err {
+	case errNotFound, errForbidden, errNotInRetro, errMixedRetros,
+		errColumnMismatch, errColumnNotEmpty, errBadRequest,
+		errWrongStage, errBadTransition, errNotFacilitator,
+		errNotOwner, errReadOnly, errNothingToUndo, errUndoConflict:
+		return err.Error()
+	case database.ErrNoVotesLeft:
+		return errNoVotesLeft.Error()
+	case database.ErrCardVoteLimit:
+		return errCardVoteLimit.Error()
+	case database.ErrColumnMismatch:
+		return errColumnMismatch.Error()
+	case database.ErrColumnNotEmpty:
+		return errColumnNotEmpty.Error()
+	case database.ErrColumnDeleted:
+		return errUndoConflict.Error()
+	case database.ErrRetroHasCards:
+		return errRetroNotEmpty.Error()
+	default:
+		return "server_error"
+	}
+}
+
+// sendError logs err and tells the client that op failed.
+func sendError(conn *sock.Conn, op string, err error) {
+	log.Println(op, conn.Name, err)
+	conn.Send("", "error", errorData{Error: errorCode(err), Op: op})
+}
@@ -0,0 +1,214 @@
+package room
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SermoDigital/jose/jws"
+	"hawx.me/code/retro/database"
+)
+
+// Export serves a retro in Markdown, CSV or JSON. The retro is given by the
+// "retro" query parameter and the format by "format", which is one of "md",
+// "csv" or "json". Requests must have the user's token either as a bearer token
+// in the Authorization header, or in the "token" query parameter.
+func (room *Room) Export(w http.ResponseWriter, r *http.Request) {
+	username, err := room.userForRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	retroId := r.FormValue("retro")
+
+	if err := room.checkParticipant(retroId, username); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	export, err := room.db.ExportRetro(retroId)
+	if err != nil {
+		log.Println("export", retroId, err)
+		http.Error(w, "could not export retro", http.StatusInternalServerError)
+		return
+	}
+	hideDrafts(&export, username)
+	anonymiseExport(&export, username)
+
+	var (
+		contentType string
+		render      func(io.Writer, database.RetroExport) error
+	)
+
+	switch r.FormValue("format") {
+	case "md", "":
+		contentType, render = "text/markdown; charset=utf-8", writeMarkdown
+	case "csv":
+		contentType, render = "text/csv; charset=utf-8", writeCSV
+	case "json":
+		contentType, render = "application/json", writeJSON
+	default:
+		http.Error(w, "unknown format", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if err := render(w, export); err != nil {
+		log.Println("export", retroId, err)
+	}
+}
+
+// userForRequest finds the user that a request is for, checking that the token
+// is valid.
+func (room *Room) userForRequest(r *http.Request) (string, error) {
+	token := r.FormValue("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		return "", errBadAuth
+	}
+
+	parsedToken, err := jws.ParseJWT([]byte(token))
+	if err != nil {
+		return "", errBadAuth
+	}
+
+	username, ok := parsedToken.Claims().Subject()
+	if !ok {
+		return "", errBadAuth
+	}
+
+	return username, room.checkToken(username, token)
+}
+
+func writeJSON(w io.Writer, export database.RetroExport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(export)
+}
+
+func writeCSV(w io.Writer, export database.RetroExport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"column", "card", "votes", "author", "text"})
+
+	for _, column := range export.Columns {
+		for _, card := range column.Cards {
+			for _, content := range card.Contents {
+				cw.Write([]string{
+					column.Name,
+					card.Id,
+					strconv.Itoa(card.TotalVotes),
+					content.Author,
+					content.Text,
+				})
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeMarkdown(w io.Writer, export database.RetroExport) error {
+	ew := &errWriter{w: w}
+
+	ew.printf("# %s\n\n", export.Name)
+	ew.printf("- Created: %s\n", export.CreatedAt.Format("2 January 2006"))
+	ew.printf("- Stage: %s\n", currentStage(export.Stage))
+	var owner string
+	var facilitators []string
+	for _, participant := range export.Participants {
+		switch export.Roles[participant] {
+		case database.RoleOwner:
+			owner = participant
+		case database.RoleFacilitator:
+			facilitators = append(facilitators, participant)
+		}
+	}
+	if owner != "" {
+		ew.printf("- Owner: %s\n", owner)
+	}
+	if len(facilitators) > 0 {
+		ew.printf("- Facilitators: %s\n", strings.Join(facilitators, ", "))
+	}
+	ew.printf("- Participants: %s\n", strings.Join(export.Participants, ", "))
+
+	for _, column := range export.Columns {
+		ew.printf("\n## %s\n", column.Name)
+		if len(column.Cards) > 0 {
+			ew.printf("\n")
+		}
+
+		for _, card := range column.Cards {
+			for i, content := range card.Contents {
+				text := strings.Replace(content.Text, "\n", " ", -1)
+
+				if i == 0 {
+					ew.printf("- (%s) %s%s\n", plural(card.TotalVotes, "vote"), text, byline(content.Author))
+				} else {
+					ew.printf("  - %s%s\n", text, byline(content.Author))
+				}
+			}
+		}
+	}
+
+	if len(export.Actions) > 0 {
+		ew.printf("\n## Actions\n\n")
+
+		for _, action := range export.Actions {
+			check := " "
+			if action.Status == database.ActionDone {
+				check = "x"
+			}
+
+			ew.printf("- [%s] %s", check, action.Text)
+			if action.Owner != "" {
+				ew.printf(" (%s)", action.Owner)
+			}
+			if action.Due != nil {
+				ew.printf(" due %s", action.Due.Format("2 January 2006"))
+			}
+			ew.printf("\n")
+		}
+	}
+
+	return ew.err
+}
+
+// byline credits the author of a card, if they are known.
+func byline(author string) string {
+	if author == "" {
+		return ""
+	}
+
+	return " — " + author
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+
+	return strconv.Itoa(n) + " " + word + "s"
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestExport(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	mallory := room.connect(t, "mallory")
+
+	retroId, columns := alice.createRetro()
+	alice.rest()
+
+	var card cardData
+	alice.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "hello\nworld"})
+	alice.expect("card", &card)
+	alice.send("reveal", map[string]string{"columnId": columns[0].ColumnId, "cardId": card.CardId})
+	alice.expect("reveal")
+
+	export := func(c *testClient, format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/export?retro="+retroId+"&format="+format, nil)
+		req.Header.Set("Authorization", "Bearer "+c.auth.Token)
+		w := httptest.NewRecorder()
+		room.Export(w, req)
+		return w
+	}
+
+	for format, expected := range map[string]string{
+		"md":  "## Start\n\n- (0 votes) hello world — alice\n",
+		"csv": "column,card,votes,author,text\nStart," + card.CardId + ",0,alice,\"hello\nworld\"\n",
+	} {
+		w := export(alice, format)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %s export to succeed, was %d", format, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected %s export to contain %q, was %q", format, expected, w.Body.String())
+		}
+	}
+
+	w := export(alice, "json")
+	var exported database.RetroExport
+	if err := json.NewDecoder(w.Body).Decode(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Id != retroId || len(exported.Columns) != 5 || len(exported.Columns[0].Cards) != 1 {
+		t.Fatalf("expected json export to have the retro's columns and card, was %+v", exported)
+	}
+	if content := exported.Columns[0].Cards[0].Contents[0]; content.Text != "hello\nworld" || content.Author != "alice" {
+		t.Fatalf("expected json export to have the card's content, was %+v", content)
+	}
+
+	if w := export(alice, "pdf"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown format to be refused, was %d", w.Code)
+	}
+	if w := export(mallory, "json"); w.Code != http.StatusNotFound {
+		t.Errorf("expected someone outside of the retro to be refused, was %d", w.Code)
+	}
+}
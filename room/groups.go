@@ -0,0 +1,67 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+
+	"hawx.me/code/retro/sock"
+)
+
+// retroGroupData shares a retro with, or stops sharing it with, everyone in a group
+// such as a GitHub organisation or team.
+type retroGroupData struct {
+	RetroId string `json:"retroId"`
+	Group   string `json:"group"`
+}
+
+func registerGroupHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("addGroup", r.participant("addGroup", func(conn *sock.Conn, data []byte) {
+		var args retroGroupData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("addGroup:", err)
+			return
+		}
+		if args.Group == "" {
+			sendError(conn, "addGroup", errBadRequest)
+			return
+		}
+
+		if err := r.db.AddRetroGroup(args.RetroId, args.Group); err != nil {
+			log.Println("addGroup db:", err)
+			return
+		}
+
+		r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name}, conn.Name, "addGroup", args)
+	}))
+
+	mux.Handle("deleteGroup", r.participant("deleteGroup", func(conn *sock.Conn, data []byte) {
+		var args retroGroupData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("deleteGroup:", err)
+			return
+		}
+
+		if err := r.db.DeleteRetroGroup(args.RetroId, args.Group); err != nil {
+			log.Println("deleteGroup db:", err)
+			return
+		}
+
+		r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name}, conn.Name, "deleteGroup", args)
+	}))
+}
+
+// joinByGroup makes username a participant of the retro if it has been shared
+// with one of their groups. It returns false if it has not.
+func (r *Room) joinByGroup(retroId, username string) (bool, error) {
+	ok, err := r.db.InRetroGroup(retroId, username)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := r.db.AddParticipant(retroId, username); err != nil {
+		return false, err
+	}
+
+	r.Server.BroadcastRetroUsers(retroId, []string{username}, "", "addParticipant", participantData{retroId, username})
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package room
+
+import "testing"
+
+func TestJoiningByGroup(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+	carol := room.connect(t, "carol")
+	dave := room.connect(t, "dave")
+
+	for _, username := range []string{"bob", "dave"} {
+		if err := room.db.SetMemberships(username, []string{"github:acme/devs"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := room.db.SetMemberships("carol", []string{"oidc:acme/devs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	retroId, _ := alice.createRetro()
+	alice.send("addGroup", retroGroupData{RetroId: retroId, Group: "github:acme/devs"})
+	alice.expect("addGroup")
+
+	var participant participantData
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	bob.expect("addParticipant", &participant)
+	if participant.Participant != "bob" {
+		t.Fatalf("expected bob to join as a participant, was %+v", participant)
+	}
+
+	var failed errorData
+	carol.send("joinRetro", map[string]string{"retroId": retroId})
+	carol.expect("error", &failed)
+	if failed.Error != errForbidden.Error() {
+		t.Fatalf("expected a group from another provider not to match, was %s", failed.Error)
+	}
+
+	alice.send("deleteGroup", retroGroupData{RetroId: retroId, Group: "github:acme/devs"})
+	alice.expect("deleteGroup")
+
+	dave.send("joinRetro", map[string]string{"retroId": retroId})
+	dave.expect("error", &failed)
+	if failed.Error != errForbidden.Error() {
+		t.Fatalf("expected the group to be removed, was %s", failed.Error)
+	}
+	if ok, err := room.db.IsParticipant(retroId, "bob"); err != nil || !ok {
+		t.Fatalf("expected bob to stay a participant: %v", err)
+	}
+}
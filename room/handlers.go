@@ -10,8 +10,26 @@ import (
 )
 
 func registerHandlers(config Config, r *Room, mux *sock.Server) {
-	mux.Auth(func(auth sock.MsgAuth) bool {
-		return r.IsUser(auth.Username, auth.Token)
+	registerActionHandlers(r, mux)
+	registerPresenceHandlers(r, mux)
+	registerHistoryHandlers(r, mux)
+	registerAnonymityHandlers(r, mux)
+	registerDraftHandlers(r, mux)
+	registerRoleHandlers(r, mux)
+	registerShareHandlers(r, mux)
+	registerTimerHandlers(r, mux)
+	registerGroupHandlers(r, mux)
+	registerSessionHandlers(r, mux)
+
+	mux.Auth(func(auth sock.MsgAuth) error {
+		if auth.Share != "" {
+			if auth.Username != "" || !r.isShare(auth.Share) {
+				return errBadAuth
+			}
+			return nil
+		}
+
+		return r.checkToken(auth.Username, auth.Token)
 	})
 
 	mux.OnConnect(func(conn *sock.Conn) {
@@ -19,53 +37,52 @@ func registerHandlers(config Config, r *Room, mux *sock.Server) {
 			HasGitHub:    config.HasGitHub,
 			HasOffice365: config.HasOffice365,
 			HasTest:      config.HasTest,
+			OIDC:         config.OIDCName,
 		})
 	})
 
-	mux.Handle("joinRetro", func(conn *sock.Conn, data []byte) {
+	mux.Handle("joinRetro", r.participant("joinRetro", func(conn *sock.Conn, data []byte) {
 		var args struct {
-			RetroId string
+			RetroId  string
+			Protocol int `json:"protocol"`
 		}
 		if err := json.Unmarshal(data, &args); err != nil {
 			log.Println("joinRetro:", err)
 			return
 		}
 
-		retro, err := r.db.GetRetro(args.RetroId)
-		if err != nil {
-			log.Println("joinRetro", args.RetroId, err)
+		r.joinRetro(conn, args.RetroId, args.Protocol)
+	}))
+
+	mux.Handle("resume", r.participant("resume", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			RetroId  string `json:"retroId"`
+			Log      string `json:"log"`
+			Seq      int64  `json:"seq"`
+			Protocol int    `json:"protocol"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("resume:", err)
 			return
 		}
-		conn.RetroId = args.RetroId
 
-		if retro.Stage != "" {
-			conn.Send("", "stage", stageData{retro.Stage})
-		}
+		wasPresent := contains(r.Server.Present(args.RetroId), conn.Name)
 
-		columns, err := r.db.GetColumns(args.RetroId)
-		if err != nil {
-			log.Println("columns", err)
+		pos, ok := conn.Resume(args.RetroId, sock.Position{Log: args.Log, Seq: args.Seq})
+		if !ok {
+			r.joinRetro(conn, args.RetroId, args.Protocol)
 			return
 		}
-		for _, column := range columns {
-			conn.Send("", "column", columnData{column.Id, column.Name, column.Order})
 
-			cards, err := r.db.GetCards(conn.Name, column.Id)
-			if err != nil {
-				log.Println(err)
-			}
-			for _, card := range cards {
-				conn.Send("", "card", cardData{column.Id, card.Id, card.Revealed, card.Votes, card.TotalVotes})
+		r.announcePresence(conn, wasPresent)
+		r.closeOnExpiry(conn)
+		r.sendTimer(conn)
+		conn.Send("", "sequence", sequenceData{pos, false})
+	}))
 
-				contents, _ := r.db.GetContents(card.Id)
-				for _, content := range contents {
-					conn.Send(content.Author, "content", contentData{column.Id, card.Id, content.Id, content.Text})
-				}
-			}
-		}
-	})
+	mux.Handle("menu", r.signedIn("menu", func(conn *sock.Conn, data []byte) {
+		conn.Join("")
 
-	mux.Handle("menu", func(conn *sock.Conn, data []byte) {
 		users, err := r.db.GetUsers()
 		if err != nil {
 			log.Println("users", err)
@@ -89,9 +106,18 @@ func registerHandlers(config Config, r *Room, mux *sock.Server) {
 
 			conn.Send("", "retro", retroData{retro.Id, retro.Name, retro.CreatedAt, participants})
 		}
-	})
 
-	mux.Handle("add", func(conn *sock.Conn, data []byte) {
+		templates, err := r.db.GetTemplates()
+		if err != nil {
+			log.Println("templates", err)
+			return
+		}
+		for _, template := range templates {
+			conn.Send("", "template", templateData{template.Id, template.Name, template.Columns})
+		}
+	}))
+
+	mux.Handle("add", r.inRetro("add", func(conn *sock.Conn, data []byte) {
 		var args struct {
 			ColumnId string
 			CardText string
@@ -124,86 +150,240 @@ func registerHandlers(config Config, r *Room, mux *sock.Server) {
 			return
 		}
 
+		r.addRevision(conn, database.Revision{
+			Kind:    database.RevisionAdd,
+			Card:    card.Id,
+			Content: content.Id,
+			Text:    content.Text,
+		})
+
 		conn.Broadcast("", "card", cardData{args.ColumnId, card.Id, card.Revealed, card.Votes, card.TotalVotes})
 
-		conn.Broadcast(content.Author, "content", contentData{args.ColumnId, content.Card, content.Id, content.Text})
-	})
+		r.broadcastContent(conn, card.Revealed, content.Author, contentData{args.ColumnId, content.Card, content.Id, content.Text, false})
+	}))
 
-	mux.Handle("edit", func(conn *sock.Conn, data []byte) {
+	mux.Handle("edit", r.inRetro("edit", func(conn *sock.Conn, data []byte) {
 		var content contentData
 		if err := json.Unmarshal(data, &content); err != nil {
-			log.Println("add:", err)
+			log.Println("edit:", err)
+			return
+		}
+
+		existing, err := r.db.GetContent(content.ContentId)
+		if err != nil {
+			log.Println("edit db:", err)
+			return
+		}
+		if existing.Author != conn.Name {
+			if err := r.checkFacilitator(conn.RetroId, conn.Name); err != nil {
+				sendError(conn, "edit", err)
+				return
+			}
+		}
+		card, err := r.db.GetCard(existing.Card)
+		if err != nil {
+			log.Println("edit db:", err)
 			return
 		}
+		before := r.cardState(existing.Card)
 
 		if err := r.db.UpdateContent(content.ContentId, content.CardText); err != nil {
 			log.Println("update db:", err)
 			return
 		}
 
-		conn.Broadcast(conn.Name, "content", content)
-	})
+		r.addRevision(conn, database.Revision{
+			Kind:    database.RevisionEdit,
+			Card:    existing.Card,
+			Content: content.ContentId,
+			Text:    content.CardText,
+			Before:  before,
+		})
+
+		r.broadcastContent(conn, card.Revealed, existing.Author, content)
+	}))
 
-	mux.Handle("move", func(conn *sock.Conn, data []byte) {
+	mux.Handle("move", r.inRetro("move", func(conn *sock.Conn, data []byte) {
 		var args moveData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.MoveCard(args.CardId, args.ColumnTo)
+		before := r.cardState(args.CardId)
 
-		conn.Broadcast(conn.Name, "move", args)
-	})
+		if err := r.db.MoveCard(args.CardId, args.ColumnTo); err != nil {
+			log.Println("move db:", err)
+			return
+		}
+
+		r.addRevision(conn, database.Revision{
+			Kind:   database.RevisionMove,
+			Card:   args.CardId,
+			Before: before,
+		})
+
+		conn.Broadcast(r.cardActor(conn), "move", args)
+	}))
 
-	mux.Handle("stage", func(conn *sock.Conn, data []byte) {
+	mux.Handle("stage", r.inRetro("stage", func(conn *sock.Conn, data []byte) {
 		var args stageData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.SetStage(conn.RetroId, args.Stage)
+		retro, err := r.db.GetRetro(conn.RetroId)
+		if err != nil {
+			log.Println("stage", err)
+			return
+		}
+
+		if err := r.checkTransition(conn.Name, retro, args.Stage); err != nil {
+			sendError(conn, "stage", err)
+			conn.Send("", "stage", stageData{currentStage(retro.Stage)})
+			return
+		}
+
+		if err := r.db.SetStage(conn.RetroId, args.Stage); err != nil {
+			sendError(conn, "stage", err)
+			conn.Send("", "stage", stageData{currentStage(retro.Stage)})
+			return
+		}
 
 		conn.Broadcast(conn.Name, "stage", args)
-	})
+	}))
 
-	mux.Handle("reveal", func(conn *sock.Conn, data []byte) {
+	mux.Handle("reveal", r.inRetro("reveal", func(conn *sock.Conn, data []byte) {
 		var args revealData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.RevealCard(args.CardId)
+		before := r.cardState(args.CardId)
+		if err := r.canChangeCard(conn.RetroId, conn.Name, before); err != nil {
+			sendError(conn, "reveal", err)
+			return
+		}
 
-		conn.Broadcast(conn.Name, "reveal", args)
-	})
+		if err := r.db.RevealCard(args.CardId); err != nil {
+			log.Println("reveal db:", err)
+			return
+		}
+
+		r.addRevision(conn, database.Revision{
+			Kind:   database.RevisionReveal,
+			Card:   args.CardId,
+			Before: before,
+		})
 
-	mux.Handle("group", func(conn *sock.Conn, data []byte) {
+		conn.Broadcast(r.cardActor(conn), "reveal", args)
+		r.broadcastContents(conn, args.CardId)
+	}))
+
+	mux.Handle("group", r.inRetro("group", func(conn *sock.Conn, data []byte) {
 		var args groupData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
+		if args.CardFrom == args.CardTo {
+			sendError(conn, "group", errBadRequest)
+			return
+		}
+
+		before := r.cardState(args.CardFrom)
+
 		err := r.db.GroupCards(args.CardFrom, args.CardTo)
 		if err != nil {
 			log.Println(err)
+			return
 		}
 
-		conn.Broadcast(conn.Name, "group", args)
-	})
+		r.addRevision(conn, database.Revision{
+			Kind:     database.RevisionGroup,
+			Card:     args.CardTo,
+			CardFrom: args.CardFrom,
+			Before:   before,
+		})
+
+		conn.Broadcast(r.cardActor(conn), "group", args)
+		r.broadcastContents(conn, args.CardTo)
+	}))
+
+	mux.Handle("ungroup", r.inRetro("ungroup", func(conn *sock.Conn, data []byte) {
+		var args ungroupData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("ungroup:", err)
+			return
+		}
+
+		before, err := r.db.GetCardState(args.CardId)
+		if err != nil {
+			sendError(conn, "ungroup", notFound(err))
+			return
+		}
+
+		if args.ColumnTo == "" || !canUngroup(before, args.ContentIds) {
+			sendError(conn, "ungroup", errBadRequest)
+			return
+		}
+
+		ungroup := database.Ungroup{
+			CardFrom: args.CardId,
+			CardTo: database.Card{
+				Id:       strId(),
+				Column:   args.ColumnTo,
+				Revealed: before.Card.Revealed,
+			},
+			Contents: args.ContentIds,
+		}
+
+		switch args.Votes {
+		case "origin", "":
+			ungroup.Votes, err = r.votesFromOrigin(args.CardId, args.ContentIds)
+			if err != nil {
+				log.Println("ungroup votes:", err)
+				return
+			}
+		case "reset":
+			ungroup.ResetVotes = true
+		default:
+			sendError(conn, "ungroup", errBadRequest)
+			return
+		}
+
+		if err := r.db.UngroupCard(ungroup); err != nil {
+			log.Println("ungroup db:", err)
+			return
+		}
 
-	mux.Handle("vote", func(conn *sock.Conn, data []byte) {
+		r.addRevision(conn, database.Revision{
+			Kind:     database.RevisionUngroup,
+			Card:     ungroup.CardTo.Id,
+			CardFrom: args.CardId,
+			Before:   &before,
+		})
+
+		r.broadcastCard(conn, args.CardId, before.Card.Column)
+		r.broadcastCard(conn, ungroup.CardTo.Id, "")
+	}))
+
+	mux.Handle("vote", r.inRetro("vote", func(conn *sock.Conn, data []byte) {
 		var args voteData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
 		args.UserId = conn.Name
-		r.db.Vote(conn.Name, args.CardId)
+		if err := r.db.VoteWithinBudget(conn.RetroId, conn.Name, args.CardId); err != nil {
+			sendError(conn, "vote", err)
+			return
+		}
 
 		conn.Broadcast(conn.Name, "vote", args)
-	})
+		r.sendVoteBudget(conn)
+	}))
 
-	mux.Handle("unvote", func(conn *sock.Conn, data []byte) {
+	mux.Handle("unvote", r.inRetro("unvote", func(conn *sock.Conn, data []byte) {
 		var args voteData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
@@ -213,43 +393,212 @@ func registerHandlers(config Config, r *Room, mux *sock.Server) {
 		r.db.Unvote(conn.Name, args.CardId)
 
 		conn.Broadcast(conn.Name, "unvote", args)
-	})
+		r.sendVoteBudget(conn)
+	}))
 
-	mux.Handle("delete", func(conn *sock.Conn, data []byte) {
+	mux.Handle("setVoteBudget", r.inRetro("setVoteBudget", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			Votes        int `json:"votes"`
+			VotesPerCard int `json:"votesPerCard"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("setVoteBudget:", err)
+			return
+		}
+
+		budget := database.VoteBudget{PerUser: args.Votes, PerCard: args.VotesPerCard}
+		if err := r.db.SetVoteBudget(conn.RetroId, budget); err != nil {
+			log.Println("setVoteBudget db:", err)
+			return
+		}
+
+		retroId := conn.RetroId
+		conn.BroadcastFunc("voteBudget", func(to *sock.Conn) (string, interface{}, bool) {
+			budgetData, err := r.voteBudget(retroId, to.Name)
+			if err != nil {
+				log.Println("setVoteBudget", to.Name, err)
+				return "", nil, false
+			}
+			return "", budgetData, true
+		})
+	}))
+
+	mux.Handle("delete", r.inRetro("delete", func(conn *sock.Conn, data []byte) {
 		var args deleteData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.DeleteCard(args.CardId)
+		before := r.cardState(args.CardId)
+		if err := r.canChangeCard(conn.RetroId, conn.Name, before); err != nil {
+			sendError(conn, "delete", err)
+			return
+		}
 
-		conn.Broadcast(conn.Name, "delete", args)
-	})
+		if err := r.db.DeleteCard(args.CardId); err != nil {
+			log.Println("delete db:", err)
+			return
+		}
 
-	mux.Handle("addParticipant", func(conn *sock.Conn, data []byte) {
+		r.addRevision(conn, database.Revision{
+			Kind:   database.RevisionDelete,
+			Card:   args.CardId,
+			Before: before,
+		})
+
+		conn.Broadcast(r.cardActor(conn), "delete", args)
+	}))
+
+	mux.Handle("addColumn", r.inRetro("addColumn", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			ColumnName string `json:"columnName"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("addColumn:", err)
+			return
+		}
+
+		columns, err := r.db.GetColumns(conn.RetroId)
+		if err != nil {
+			log.Println("addColumn columns", err)
+			return
+		}
+
+		column := database.Column{
+			Id:    strId(),
+			Retro: conn.RetroId,
+			Name:  args.ColumnName,
+			Order: len(columns),
+		}
+		if len(columns) > 0 {
+			column.Order = columns[len(columns)-1].Order + 1
+		}
+
+		if err := r.db.AddColumn(column); err != nil {
+			log.Println("addColumn db:", err)
+			return
+		}
+
+		conn.Broadcast("", "column", columnData{column.Id, column.Name, column.Order})
+	}))
+
+	mux.Handle("renameColumn", r.inRetro("renameColumn", func(conn *sock.Conn, data []byte) {
+		var args renameColumnData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("renameColumn:", err)
+			return
+		}
+
+		if err := r.db.RenameColumn(args.ColumnId, args.ColumnName); err != nil {
+			log.Println("renameColumn db:", err)
+			return
+		}
+
+		conn.Broadcast(conn.Name, "renameColumn", args)
+	}))
+
+	mux.Handle("reorderColumns", r.inRetro("reorderColumns", func(conn *sock.Conn, data []byte) {
+		var args reorderColumnsData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("reorderColumns:", err)
+			return
+		}
+
+		if err := r.db.ReorderColumns(conn.RetroId, args.ColumnIds); err != nil {
+			sendError(conn, "reorderColumns", err)
+			return
+		}
+
+		conn.Broadcast(conn.Name, "reorderColumns", args)
+	}))
+
+	mux.Handle("deleteColumn", r.inRetro("deleteColumn", func(conn *sock.Conn, data []byte) {
+		var args deleteColumnData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("deleteColumn:", err)
+			return
+		}
+
+		if args.ColumnId == "" || args.ColumnTo == args.ColumnId || (args.ColumnTo != "" && args.DeleteCards) {
+			sendError(conn, "deleteColumn", errBadRequest)
+			return
+		}
+
+		var deleted []*database.CardState
+		var cardIds []string
+		if args.DeleteCards {
+			cards, err := r.db.GetCards(conn.Name, args.ColumnId)
+			if err != nil {
+				sendError(conn, "deleteColumn", err)
+				return
+			}
+			for _, card := range cards {
+				if state := r.cardState(card.Id); state != nil {
+					deleted = append(deleted, state)
+					cardIds = append(cardIds, card.Id)
+				}
+			}
+		}
+
+		if err := r.db.DeleteColumn(args.ColumnId, args.ColumnTo, cardIds); err != nil {
+			sendError(conn, "deleteColumn", err)
+			return
+		}
+
+		for _, state := range deleted {
+			r.addRevision(conn, database.Revision{
+				Kind:   database.RevisionDelete,
+				Card:   state.Card.Id,
+				Before: state,
+			})
+		}
+
+		conn.Broadcast(conn.Name, "deleteColumn", args)
+	}))
+
+	mux.Handle("addParticipant", r.participant("addParticipant", func(conn *sock.Conn, data []byte) {
 		var args participantData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.AddParticipant(args.RetroId, args.Participant)
-		conn.Broadcast(conn.Name, "addParticipant", args)
-	})
+		if err := r.db.AddParticipant(args.RetroId, args.Participant); err != nil {
+			sendError(conn, "addParticipant", err)
+			return
+		}
+		r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name, args.Participant}, conn.Name, "addParticipant", args)
+	}))
 
-	mux.Handle("deleteParticipant", func(conn *sock.Conn, data []byte) {
+	mux.Handle("deleteParticipant", r.participant("deleteParticipant", func(conn *sock.Conn, data []byte) {
 		var args participantData
 		if err := json.Unmarshal(data, &args); err != nil {
 			return
 		}
 
-		r.db.DeleteParticipant(args.RetroId, args.Participant)
-		conn.Broadcast(conn.Name, "deleteParticipant", args)
-	})
+		if role, _ := r.db.GetRole(args.RetroId, args.Participant); role == database.RoleOwner {
+			sendError(conn, "deleteParticipant", errForbidden)
+			return
+		}
 
-	mux.Handle("createRetro", func(conn *sock.Conn, data []byte) {
+		if err := r.db.DeleteParticipant(args.RetroId, args.Participant); err != nil {
+			sendError(conn, "deleteParticipant", err)
+			return
+		}
+		r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name, args.Participant}, conn.Name, "deleteParticipant", args)
+	}))
+
+	mux.Handle("createRetro", r.signedIn("createRetro", func(conn *sock.Conn, data []byte) {
 		var args struct {
-			Name  string   `json:"name"`
-			Users []string `json:"users"`
+			Name     string   `json:"name"`
+			Users    []string `json:"users"`
+			Template string   `json:"template"`
+
+			// Votes and VotesPerCard set the vote budget for the retro, if they
+			// are zero there is no limit.
+			Votes        int `json:"votes"`
+			VotesPerCard int `json:"votesPerCard"`
+
+			Anonymous bool `json:"anonymous"`
 		}
 
 		if err := json.Unmarshal(data, &args); err != nil {
@@ -257,59 +606,144 @@ func registerHandlers(config Config, r *Room, mux *sock.Server) {
 			return
 		}
 
+		if args.Template == "" {
+			args.Template = config.DefaultTemplate
+		}
+
+		template, err := r.db.GetTemplate(args.Template)
+		if err != nil {
+			sendError(conn, "createRetro", notFound(err))
+			return
+		}
+
 		retroId := strId()
 		createdAt := time.Now()
 
-		r.db.AddRetro(database.Retro{
+		err = r.db.AddRetro(database.Retro{
 			Id:        retroId,
 			Name:      args.Name,
 			Stage:     "",
 			CreatedAt: createdAt,
+			Anonymous: args.Anonymous,
 		})
+		if err != nil {
+			sendError(conn, "createRetro", err)
+			return
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Start",
-			Order: 0,
-		})
+		for i, name := range template.Columns {
+			err := r.db.AddColumn(database.Column{
+				Id:    strId(),
+				Retro: retroId,
+				Name:  name,
+				Order: i,
+			})
+			if err != nil {
+				sendError(conn, "createRetro", err)
+				return
+			}
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "More",
-			Order: 1,
-		})
+		allParticipants := append(args.Users, conn.Name)
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Keep",
-			Order: 2,
+		for _, user := range allParticipants {
+			if err := r.db.AddParticipant(retroId, user); err != nil {
+				sendError(conn, "createRetro", err)
+				return
+			}
+		}
+		if err := r.db.SetRole(retroId, conn.Name, database.RoleOwner); err != nil {
+			sendError(conn, "createRetro", err)
+			return
+		}
+		err = r.db.SetVoteBudget(retroId, database.VoteBudget{
+			PerUser: args.Votes,
+			PerCard: args.VotesPerCard,
 		})
+		if err != nil {
+			sendError(conn, "createRetro", err)
+			return
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Less",
-			Order: 3,
-		})
+		if err := r.carryActions(retroId, allParticipants); err != nil {
+			log.Println("createRetro actions", err)
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Stop",
-			Order: 4,
-		})
+		conn.Send(conn.Name, "retro", retroData{retroId, args.Name, createdAt, allParticipants})
+	}))
 
-		allParticipants := append(args.Users, conn.Name)
+	mux.Handle("saveTemplate", r.participant("saveTemplate", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			RetroId string `json:"retroId"`
+			Name    string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("saveTemplate:", err)
+			return
+		}
 
-		for _, user := range allParticipants {
-			r.db.AddParticipant(retroId, user)
+		// Only finished retros can be saved, so that the template has the columns
+		// that the retro was run with.
+		if err := r.checkStage("saveTemplate", args.RetroId); err != nil {
+			sendError(conn, "saveTemplate", err)
+			return
 		}
 
-		conn.Send(conn.Name, "retro", retroData{retroId, args.Name, createdAt, allParticipants})
-	})
+		columns, err := r.db.GetColumns(args.RetroId)
+		if err != nil {
+			log.Println("saveTemplate columns", err)
+			return
+		}
+
+		template := database.Template{
+			Id:   strId(),
+			Name: args.Name,
+		}
+		for _, column := range columns {
+			if column.Name == "" || contains(template.Columns, column.Name) {
+				sendError(conn, "saveTemplate", errBadRequest)
+				return
+			}
+			template.Columns = append(template.Columns, column.Name)
+		}
+		if args.Name == "" || len(template.Columns) == 0 {
+			sendError(conn, "saveTemplate", errBadRequest)
+			return
+		}
+
+		if err := r.db.SetTemplate(template); err != nil {
+			log.Println("saveTemplate db:", err)
+			return
+		}
+
+		conn.BroadcastAll(conn.Name, "template", templateData{template.Id, template.Name, template.Columns})
+	}))
+}
+
+// joinRetro moves the connection into the retro and sends it everything in the
+// retro.
+func (r *Room) joinRetro(conn *sock.Conn, retroId string, protocol int) {
+	wasPresent := contains(r.Server.Present(retroId), conn.Name)
+
+	pos := conn.Join(retroId)
+	conn.Send("", "sequence", sequenceData{pos, true})
+
+	r.announcePresence(conn, wasPresent)
+	r.closeOnExpiry(conn)
+
+	snapshot, err := r.db.GetRetroSnapshot(retroId, conn.Name)
+	if err != nil {
+		log.Println("joinRetro", retroId, err)
+		return
+	}
+
+	budget, err := r.voteBudget(retroId, conn.Name)
+	if err != nil {
+		log.Println("joinRetro voteBudget", retroId, err)
+		return
+	}
+
+	sendSnapshot(conn, snapshot, budget, protocol)
 }
 
 type msg struct {
@@ -320,12 +754,23 @@ type msg struct {
 
 type errorData struct {
 	Error string `json:"error"`
+	Op    string `json:"op,omitempty"`
 }
 
 type helloData struct {
-	HasGitHub    bool `json:"hasGitHub"`
-	HasOffice365 bool `json:"hasOffice365"`
-	HasTest      bool `json:"hasTest"`
+	HasGitHub    bool   `json:"hasGitHub"`
+	HasOffice365 bool   `json:"hasOffice365"`
+	HasTest      bool   `json:"hasTest"`
+	OIDC         string `json:"oidc,omitempty"`
+}
+
+// sequenceData tells a connection the position in the retro's events that it
+// has been sent everything up to. Snapshot is true when it is about to be sent
+// everything in the retro, so should forget what it already has. Clients should
+// resume from the highest seq they have seen, from this or any later message.
+type sequenceData struct {
+	sock.Position
+	Snapshot bool `json:"snapshot"`
 }
 
 type stageData struct {
@@ -338,6 +783,23 @@ type columnData struct {
 	ColumnOrder int    `json:"columnOrder"`
 }
 
+type renameColumnData struct {
+	ColumnId   string `json:"columnId"`
+	ColumnName string `json:"columnName"`
+}
+
+type reorderColumnsData struct {
+	ColumnIds []string `json:"columnIds"`
+}
+
+// deleteColumnData describes a column to delete. If the column has cards then
+// either ColumnTo must be given to move them to, or DeleteCards must be set.
+type deleteColumnData struct {
+	ColumnId    string `json:"columnId"`
+	ColumnTo    string `json:"columnTo"`
+	DeleteCards bool   `json:"deleteCards"`
+}
+
 type cardData struct {
 	ColumnId   string `json:"columnId"`
 	CardId     string `json:"cardId"`
@@ -346,11 +808,15 @@ type cardData struct {
 	TotalVotes int    `json:"totalVotes"`
 }
 
+// contentData is the text written on a card. Hidden is set, and CardText is
+// empty, when the card has not been revealed and the text was written by
+// another user.
 type contentData struct {
 	ColumnId  string `json:"columnId"`
 	CardId    string `json:"cardId"`
 	ContentId string `json:"contentId"`
 	CardText  string `json:"cardText"`
+	Hidden    bool   `json:"hidden,omitempty"`
 }
 
 type moveData struct {
@@ -371,6 +837,24 @@ type groupData struct {
 	CardTo     string `json:"cardTo"`
 }
 
+// ungroupData moves the contents listed from a card to a new card in columnTo.
+// Votes is "origin" to move the votes that came with the contents when they were
+// grouped, or "reset" to remove the votes from the card.
+type ungroupData struct {
+	CardId     string   `json:"cardId"`
+	ColumnTo   string   `json:"columnTo"`
+	ContentIds []string `json:"contentIds"`
+	Votes      string   `json:"votes"`
+}
+
+// voteBudgetData tells a user how many votes they can use. Remaining is null
+// when there is no limit.
+type voteBudgetData struct {
+	Votes        int  `json:"votes"`
+	VotesPerCard int  `json:"votesPerCard"`
+	Remaining    *int `json:"remaining"`
+}
+
 type voteData struct {
 	UserId   string `json:"userId"`
 	ColumnId string `json:"columnId"`
@@ -398,6 +882,12 @@ type retroData struct {
 	Participants []string  `json:"participants"`
 }
 
+type templateData struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
 func boolToString(b bool) string {
 	if b {
 		return "true"
@@ -0,0 +1,243 @@
+package room
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+type revisionData struct {
+	RevisionId int64     `json:"revisionId"`
+	Kind       string    `json:"kind"`
+	CardId     string    `json:"cardId"`
+	CardFrom   string    `json:"cardFrom,omitempty"`
+	ContentId  string    `json:"contentId,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Undone     bool      `json:"undone"`
+}
+
+type historyData struct {
+	CardId    string         `json:"cardId"`
+	Revisions []revisionData `json:"revisions"`
+}
+
+func registerHistoryHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("undo", r.inRetro("undo", func(conn *sock.Conn, data []byte) {
+		revision, err := r.db.GetLastRevision(conn.RetroId, conn.Name)
+		if err == sql.ErrNoRows {
+			sendError(conn, "undo", errNothingToUndo)
+			return
+		}
+		if err != nil {
+			sendError(conn, "undo", err)
+			return
+		}
+
+		if ok, err := r.db.IsLatestRevision(revision); err != nil || !ok {
+			if err == nil {
+				err = errUndoConflict
+			}
+			sendError(conn, "undo", err)
+			return
+		}
+
+		cardIds := []string{revision.Card}
+		if revision.CardFrom != "" {
+			cardIds = append(cardIds, revision.CardFrom)
+		}
+
+		columnsWas := map[string]string{}
+		for _, cardId := range cardIds {
+			if card, err := r.db.GetCard(cardId); err == nil {
+				columnsWas[cardId] = card.Column
+			}
+		}
+
+		if err := r.db.UndoRevision(revision); err != nil {
+			sendError(conn, "undo", err)
+			return
+		}
+
+		for _, cardId := range cardIds {
+			r.broadcastCard(conn, cardId, columnsWas[cardId])
+		}
+	}))
+
+	mux.Handle("history", r.inRetro("history", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			CardId string `json:"cardId"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("history:", err)
+			return
+		}
+
+		revisions, err := r.db.GetCardRevisions(args.CardId)
+		if err != nil {
+			sendError(conn, "history", err)
+			return
+		}
+
+		anonymous := r.isAnonymous(conn.RetroId)
+		card, err := r.db.GetCard(args.CardId)
+		revealed := err == nil && card.Revealed
+
+		history := historyData{CardId: args.CardId, Revisions: []revisionData{}}
+		for _, revision := range revisions {
+			text := revision.Text
+			if !revealed && revision.Author != conn.Name {
+				text = ""
+			}
+
+			history.Revisions = append(history.Revisions, revisionData{
+				RevisionId: revision.Id,
+				Kind:       revision.Kind,
+				CardId:     revision.Card,
+				CardFrom:   revision.CardFrom,
+				ContentId:  revision.Content,
+				Text:       text,
+				Author:     authorFor(anonymous, revision.Author, conn.Name),
+				CreatedAt:  revision.CreatedAt,
+				Undone:     revision.Undone,
+			})
+		}
+
+		conn.Send("", "history", history)
+	}))
+}
+
+// cardState reads the card before it is changed, so that the change can be
+// undone. It returns nil if the card can not be read.
+func (r *Room) cardState(cardId string) *database.CardState {
+	state, err := r.db.GetCardState(cardId)
+	if err != nil {
+		log.Println("cardState", cardId, err)
+		return nil
+	}
+
+	return &state
+}
+
+// addRevision records a change made by the connection's user.
+func (r *Room) addRevision(conn *sock.Conn, revision database.Revision) {
+	revision.Retro = conn.RetroId
+	revision.Author = conn.Name
+	revision.CreatedAt = time.Now()
+
+	if err := r.db.AddRevision(revision); err != nil {
+		log.Println("addRevision", revision.Kind, revision.Card, err)
+	}
+}
+
+// broadcastCard sends the card, and its contents, to everyone in the retro to
+// replace the copy they have. columnWas is the column they have it in, if any.
+// If the card no longer exists it is deleted.
+func (r *Room) broadcastCard(conn *sock.Conn, cardId, columnWas string) {
+	state, err := r.db.GetCardState(cardId)
+	if err == sql.ErrNoRows {
+		if columnWas != "" {
+			conn.Broadcast(r.cardActor(conn), "delete", deleteData{columnWas, cardId})
+		}
+		return
+	}
+	if err != nil {
+		log.Println("broadcastCard", cardId, err)
+		return
+	}
+
+	card := state.Card
+	if columnWas != "" && columnWas != card.Column {
+		conn.Broadcast(r.cardActor(conn), "delete", deleteData{columnWas, cardId})
+	}
+
+	conn.BroadcastFunc("card", func(to *sock.Conn) (string, interface{}, bool) {
+		votes := 0
+		for _, vote := range state.Votes {
+			if vote.Username == to.Name {
+				votes++
+			}
+		}
+
+		return "", cardData{card.Column, card.Id, card.Revealed, votes, card.TotalVotes}, true
+	})
+
+	r.sendContents(conn, state)
+}
+
+// broadcastContents sends the contents of the card to everyone in the retro, so
+// that they are shown the text when it is revealed or moved to another card.
+func (r *Room) broadcastContents(conn *sock.Conn, cardId string) {
+	state, err := r.db.GetCardState(cardId)
+	if err != nil {
+		log.Println("broadcastContents", cardId, err)
+		return
+	}
+
+	r.sendContents(conn, state)
+}
+
+func (r *Room) sendContents(conn *sock.Conn, state database.CardState) {
+	for _, content := range state.Contents {
+		r.broadcastContent(conn, state.Card.Revealed, content.Author,
+			contentData{state.Card.Column, state.Card.Id, content.Id, content.Text, false})
+	}
+}
+
+// canUngroup checks that contentIds lists some, but not all, of the card's
+// contents.
+func canUngroup(state database.CardState, contentIds []string) bool {
+	if len(contentIds) == 0 || len(contentIds) >= len(state.Contents) {
+		return false
+	}
+
+	var ids []string
+	for _, content := range state.Contents {
+		ids = append(ids, content.Id)
+	}
+
+	for _, contentId := range contentIds {
+		if !contains(ids, contentId) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// votesFromOrigin finds the votes that were moved to the card when the contents
+// were grouped in to it. Votes are only found for a card that was grouped in
+// when every one of its contents is being moved.
+func (r *Room) votesFromOrigin(cardId string, contentIds []string) ([]int64, error) {
+	revisions, err := r.db.GetCardRevisions(cardId)
+	if err != nil {
+		return nil, err
+	}
+
+	var votes []int64
+	for _, revision := range revisions {
+		if revision.Kind != database.RevisionGroup || revision.Card != cardId || revision.Undone || revision.Before == nil {
+			continue
+		}
+
+		allMoved := len(revision.Before.Contents) > 0
+		for _, content := range revision.Before.Contents {
+			if !contains(contentIds, content.Id) {
+				allMoved = false
+			}
+		}
+
+		if allMoved {
+			for _, vote := range revision.Before.Votes {
+				votes = append(votes, vote.Id)
+			}
+		}
+	}
+
+	return votes, nil
+}
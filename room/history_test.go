@@ -0,0 +1,69 @@
+package room
+
+import (
+	"testing"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestUndoAndHistory(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	retroId, columns := alice.createRetro("bob")
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	alice.rest()
+	bob.rest()
+
+	var content contentData
+	alice.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "hello"})
+	alice.expect("content", &content)
+	alice.send("edit", contentData{ContentId: content.ContentId, CardText: "goodbye"})
+	alice.expect("content")
+	alice.rest()
+	bob.rest()
+
+	var failed errorData
+	bob.send("undo", struct{}{})
+	bob.expect("error", &failed)
+	if failed.Error != errNothingToUndo.Error() {
+		t.Fatalf("expected bob to have nothing to undo, was %s", failed.Error)
+	}
+
+	var history historyData
+	alice.send("history", map[string]string{"cardId": content.CardId})
+	alice.expect("history", &history)
+	if len(history.Revisions) != 2 ||
+		history.Revisions[0].Kind != database.RevisionAdd ||
+		history.Revisions[1].Kind != database.RevisionEdit || history.Revisions[1].Text != "goodbye" {
+		t.Fatalf("expected the card to have been added then edited, was %+v", history.Revisions)
+	}
+
+	alice.send("undo", struct{}{})
+	alice.expect("content")
+	if stored, _ := room.db.GetContent(content.ContentId); stored.Text != "hello" {
+		t.Fatalf("expected undo to restore the text, was %s", stored.Text)
+	}
+
+	alice.send("history", map[string]string{"cardId": content.CardId})
+	alice.expect("history", &history)
+	if len(history.Revisions) != 2 || history.Revisions[0].Undone || !history.Revisions[1].Undone {
+		t.Fatalf("expected only the edit to be undone, was %+v", history.Revisions)
+	}
+
+	alice.send("undo", struct{}{})
+	var deleted deleteData
+	bob.expect("delete", &deleted)
+	if deleted.CardId != content.CardId {
+		t.Fatalf("expected undoing the add to delete the card, was %+v", deleted)
+	}
+
+	alice.send("undo", struct{}{})
+	alice.expect("error", &failed)
+	if failed.Error != errNothingToUndo.Error() {
+		t.Fatalf("expected nothing left to undo, was %s", failed.Error)
+	}
+}
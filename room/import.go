@@ -0,0 +1,402 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"hawx.me/code/retro/database"
+)
+
+// The largest retro that can be imported. Votes are stored one row each, so
+// they are limited per card as well as the size of the body.
+const (
+	maxImportSize         = 10 << 20
+	maxImportParticipants = 500
+	maxImportCards        = 5000
+	maxImportVotes        = 1000
+)
+
+// ImportError lists the problems found with a retro that was being imported.
+type ImportError struct {
+	Problems []string
+}
+
+func (e *ImportError) Error() string {
+	return "invalid retro: " + strings.Join(e.Problems, "; ")
+}
+
+// DecodeImport reads a retro in the JSON export format.
+func DecodeImport(r io.Reader) (database.RetroExport, error) {
+	var export database.RetroExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return export, &ImportError{Problems: []string{"could not decode json: " + err.Error()}}
+	}
+
+	return export, nil
+}
+
+// Import adds a retro from an export to the database. Usernames in the export
+// are replaced using the usernames map, if they are present. The users named in
+// an export can not be trusted, so only those that local returns true for are
+// kept: anyone else is removed from the participants, and their cards, votes
+// and actions are kept without a user. Users are never created. New ids are
+// given to everything in the retro, so the same export can be imported many
+// times. It returns the id of the new retro.
+func Import(db database.Storage, export database.RetroExport, usernames map[string]string, local func(username string) bool) (string, error) {
+	if export.Facilitator != "" && export.Roles[export.Facilitator] == "" {
+		if export.Roles == nil {
+			export.Roles = map[string]string{}
+		}
+		export.Roles[export.Facilitator] = database.RoleOwner
+	}
+	export.Facilitator = ""
+
+	mapUsers(&export, usernames)
+
+	if err := validateImport(export); err != nil {
+		return "", err
+	}
+
+	forgetUsers(&export, local)
+	if len(export.Participants) == 0 {
+		return "", &ImportError{Problems: []string{"participants has no users of this retro"}}
+	}
+
+	renumber(&export)
+
+	if err := db.ImportRetro(export); err != nil {
+		return "", err
+	}
+
+	return export.Id, nil
+}
+
+// ImportHandler accepts a retro in the JSON export format as the body of a POST
+// request, and imports it. The user making the request is the only user kept in
+// the imported retro, and is made its owner. Which name in the export is theirs
+// can be given by passing a "user" query parameter of the form "external=local",
+// where local is their username. It responds with the id of the new retro.
+func (room *Room) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, err := room.userForRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	usernames := map[string]string{}
+	for _, pair := range r.URL.Query()["user"] {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			http.Error(w, "user must be of the form external=local", http.StatusBadRequest)
+			return
+		}
+		if parts[1] != username {
+			http.Error(w, "users can only be mapped to yourself", http.StatusBadRequest)
+			return
+		}
+		usernames[parts[0]] = parts[1]
+	}
+
+	export, err := DecodeImport(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !contains(export.Participants, username) {
+		export.Participants = append(export.Participants, username)
+	}
+
+	retroId, err := Import(room.db, export, usernames, func(local string) bool {
+		return local == username
+	})
+	if err != nil {
+		if _, ok := err.(*ImportError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Println("import", err)
+		http.Error(w, "could not import retro", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Id string `json:"id"`
+	}{retroId})
+}
+
+func mapUsers(export *database.RetroExport, usernames map[string]string) {
+	mapUser := func(username string) string {
+		if mapped, ok := usernames[username]; ok {
+			return mapped
+		}
+		return username
+	}
+
+	for i, participant := range export.Participants {
+		export.Participants[i] = mapUser(participant)
+	}
+
+	roles := map[string]string{}
+	for username, role := range export.Roles {
+		roles[mapUser(username)] = role
+	}
+	export.Roles = roles
+
+	for i := range export.Columns {
+		for j := range export.Columns[i].Cards {
+			card := &export.Columns[i].Cards[j]
+
+			for k := range card.Contents {
+				card.Contents[k].Author = mapUser(card.Contents[k].Author)
+			}
+
+			votes := map[string]int{}
+			for username, count := range card.Votes {
+				votes[mapUser(username)] += count
+			}
+			card.Votes = votes
+		}
+	}
+
+	for i := range export.Actions {
+		export.Actions[i].Owner = mapUser(export.Actions[i].Owner)
+	}
+}
+
+func validateImport(export database.RetroExport) error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if export.Name == "" {
+		problem("name is missing")
+	}
+	if export.CreatedAt.IsZero() {
+		problem("createdAt is missing")
+	}
+	if _, ok := transitions[export.Stage]; export.Stage != "" && !ok {
+		problem("stage %q is not known", export.Stage)
+	}
+
+	participants := map[string]bool{}
+	for i, participant := range export.Participants {
+		if participant == "" {
+			problem("participants[%d] is empty", i)
+		}
+		if participants[participant] {
+			problem("participants[%d] %q is repeated", i, participant)
+		}
+		participants[participant] = true
+	}
+	if len(export.Participants) == 0 {
+		problem("participants is empty")
+	}
+	if len(export.Participants) > maxImportParticipants {
+		problem("participants has more than %d users", maxImportParticipants)
+	}
+
+	isParticipant := func(path, username string) {
+		if username != "" && !participants[username] {
+			problem("%s %q is not a participant", path, username)
+		}
+	}
+
+	owners := 0
+	for username, role := range export.Roles {
+		isParticipant("roles", username)
+		if !contains(database.Roles, role) {
+			problem("roles %q is not known", role)
+		}
+		if role == database.RoleOwner {
+			owners++
+		}
+	}
+	if owners > 1 {
+		problem("roles has more than one owner")
+	}
+
+	if export.VoteBudget.PerUser < 0 || export.VoteBudget.PerCard < 0 {
+		problem("voteBudget can not be negative")
+	}
+
+	if len(export.Columns) == 0 {
+		problem("columns is empty")
+	}
+
+	cards := map[string]bool{}
+	cardCount := 0
+	for i, column := range export.Columns {
+		path := fmt.Sprintf("columns[%d]", i)
+
+		if column.Name == "" {
+			problem("%s.name is missing", path)
+		}
+
+		cardCount += len(column.Cards)
+
+		for j, card := range column.Cards {
+			path := fmt.Sprintf("%s.cards[%d]", path, j)
+			cards[card.Id] = true
+
+			if len(card.Contents) == 0 {
+				problem("%s.contents is empty", path)
+			}
+
+			for k, content := range card.Contents {
+				path := fmt.Sprintf("%s.contents[%d]", path, k)
+
+				// exports of anonymous retros used to give authors pseudonyms
+				if !export.Anonymous {
+					isParticipant(path+".author", content.Author)
+				}
+			}
+
+			votes, tooManyVotes := 0, false
+			for username, count := range card.Votes {
+				if count < 0 {
+					problem("%s.votes[%q] can not be negative", path, username)
+				} else if count > maxImportVotes-votes {
+					tooManyVotes = true
+				} else {
+					votes += count
+				}
+				isParticipant(path+".votes", username)
+			}
+			if tooManyVotes {
+				problem("%s.votes has more than %d votes", path, maxImportVotes)
+			}
+		}
+	}
+	if cardCount > maxImportCards {
+		problem("columns has more than %d cards", maxImportCards)
+	}
+
+	for i, action := range export.Actions {
+		path := fmt.Sprintf("actions[%d]", i)
+
+		if action.Text == "" {
+			problem("%s.text is missing", path)
+		}
+		if action.Status != "" && action.Status != database.ActionOpen && action.Status != database.ActionDone {
+			problem("%s.status %q is not known", path, action.Status)
+		}
+		if action.Card != "" && !cards[action.Card] {
+			problem("%s.card %q is not in the retro", path, action.Card)
+		}
+		isParticipant(path+".owner", action.Owner)
+	}
+
+	if len(problems) > 0 {
+		return &ImportError{Problems: problems}
+	}
+
+	return nil
+}
+
+// renumber gives new ids to everything in the retro.
+func renumber(export *database.RetroExport) {
+	export.Id = strId()
+
+	cardIds := map[string]string{}
+	for i := range export.Columns {
+		column := &export.Columns[i]
+		column.Id = strId()
+
+		for j := range column.Cards {
+			card := &column.Cards[j]
+
+			newId := strId()
+			cardIds[card.Id] = newId
+			card.Id = newId
+
+			for k := range card.Contents {
+				card.Contents[k].Id = strId()
+			}
+		}
+	}
+
+	for i := range export.Actions {
+		action := &export.Actions[i]
+		action.Id = strId()
+		action.Card = cardIds[action.Card]
+
+		if action.Status == "" {
+			action.Status = database.ActionOpen
+		}
+	}
+}
+
+func hasOwner(export database.RetroExport) bool {
+	for _, role := range export.Roles {
+		if role == database.RoleOwner {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forgetUsers removes the users that local returns false for from the export.
+// They are no longer participants, and their cards, votes and actions have no
+// user. If the owner is removed the first participant left becomes the owner.
+func forgetUsers(export *database.RetroExport, local func(username string) bool) {
+	known := func(username string) string {
+		if username != "" && local(username) {
+			return username
+		}
+		return ""
+	}
+
+	var participants []string
+	for _, participant := range export.Participants {
+		if known(participant) != "" {
+			participants = append(participants, participant)
+		}
+	}
+	export.Participants = participants
+
+	roles := map[string]string{}
+	for username, role := range export.Roles {
+		if known(username) != "" {
+			roles[username] = role
+		}
+	}
+	export.Roles = roles
+	if !hasOwner(*export) && len(participants) > 0 {
+		export.Roles[participants[0]] = database.RoleOwner
+	}
+
+	for i := range export.Columns {
+		for j := range export.Columns[i].Cards {
+			card := &export.Columns[i].Cards[j]
+
+			for k := range card.Contents {
+				card.Contents[k].Author = known(card.Contents[k].Author)
+			}
+
+			votes := map[string]int{}
+			for username, count := range card.Votes {
+				votes[known(username)] += count
+			}
+			card.Votes = votes
+		}
+	}
+
+	for i := range export.Actions {
+		export.Actions[i].Owner = known(export.Actions[i].Owner)
+	}
+}
@@ -0,0 +1,159 @@
+package room
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestImportAnonymousExport(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	for _, username := range []string{"alice", "bob", "carol", "anonymous-1"} {
+		if _, err := room.AddUser(username); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := database.RetroExport{
+		Id:           "r1",
+		Name:         "Anonymous",
+		Stage:        Done,
+		CreatedAt:    time.Now(),
+		Anonymous:    true,
+		Participants: []string{"alice", "bob", "carol"},
+		Roles:        map[string]string{"alice": database.RoleOwner},
+		Columns: []database.ColumnExport{{
+			Id:   "c1",
+			Name: "Start",
+			Cards: []database.CardExport{
+				{Id: "a", Contents: []database.ContentExport{{Id: "a1", Text: "one", Author: "bob"}}},
+				{Id: "b", Contents: []database.ContentExport{{Id: "b1", Text: "two", Author: "alice"}}},
+				{Id: "c", Contents: []database.ContentExport{
+					{Id: "c1", Text: "three", Author: "carol"},
+					{Id: "c2", Text: "four", Author: "anonymous-1"},
+				}},
+			},
+		}},
+	}
+
+	anonymiseExport(&export, "alice")
+
+	authors := func(export database.RetroExport) []string {
+		var authors []string
+		for _, card := range export.Columns[0].Cards {
+			for _, content := range card.Contents {
+				authors = append(authors, content.Author)
+			}
+		}
+		sort.Strings(authors)
+		return authors
+	}
+
+	expected := []string{"", "", "", "alice"}
+	if actual := authors(export); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected exported authors %q, were %q", expected, actual)
+	}
+
+	retroId, err := Import(room.db, export, nil, func(username string) bool {
+		_, err := room.db.GetUser(username)
+		return err == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := room.db.ExportRetro(retroId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := authors(imported); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected imported authors %q, were %q", expected, actual)
+	}
+}
+
+func TestImportCanNotImpersonateUsers(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	if _, err := room.AddUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := room.AddUser("mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := database.RetroExport{
+		Name:         "Forged",
+		CreatedAt:    time.Now(),
+		Participants: []string{"bob", "eve"},
+		Roles:        map[string]string{"bob": database.RoleOwner, "eve": database.RoleFacilitator},
+		Columns: []database.ColumnExport{{
+			Name: "Start",
+			Cards: []database.CardExport{{
+				Id:       "a",
+				Revealed: true,
+				Votes:    map[string]int{"bob": 2, "eve": 1},
+				Contents: []database.ContentExport{{Text: "written by bob", Author: "bob"}},
+			}},
+		}},
+		Actions: []database.ActionExport{{Text: "bob will do it", Owner: "bob"}},
+	}
+
+	importAs := func(query string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(export)
+		r := httptest.NewRequest("POST", "/import"+query, bytes.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+tokens.Token)
+		w := httptest.NewRecorder()
+		room.ImportHandler(w, r)
+		return w
+	}
+
+	if w := importAs("?user=eve=bob"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected mapping to another user to be refused, was %d", w.Code)
+	}
+
+	w := importAs("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected import to succeed, was %d: %s", w.Code, w.Body)
+	}
+	var imported struct{ Id string }
+	if err := json.NewDecoder(w.Body).Decode(&imported); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := room.db.GetUser("eve"); err != sql.ErrNoRows {
+		t.Errorf("expected eve not to be created, was %v", err)
+	}
+	if _, err := room.db.GetRole(imported.Id, "bob"); err != sql.ErrNoRows {
+		t.Errorf("expected bob not to be in the retro, was %v", err)
+	}
+	if role, err := room.db.GetRole(imported.Id, "mallory"); err != nil || role != database.RoleOwner {
+		t.Errorf("expected mallory to own the retro, was %q %v", role, err)
+	}
+
+	retro, err := room.db.ExportRetro(imported.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := retro.Columns[0].Cards[0]
+	if author := card.Contents[0].Author; author != "" {
+		t.Errorf("expected the card to have no author, was %q", author)
+	}
+	if card.TotalVotes != 3 || card.Votes["bob"] != 0 {
+		t.Errorf("expected 3 votes by no user, was %v", card.Votes)
+	}
+	if owner := retro.Actions[0].Owner; owner != "" {
+		t.Errorf("expected the action to have no owner, was %q", owner)
+	}
+}
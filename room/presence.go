@@ -0,0 +1,178 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hawx.me/code/retro/sock"
+)
+
+// typingTimeout is how long a user is shown as typing after their last typing
+// message. Clients should repeat the message while the user is still typing.
+const typingTimeout = 5 * time.Second
+
+const (
+	presenceJoin     = "join"
+	presenceLeave    = "leave"
+	presenceSnapshot = "snapshot"
+)
+
+type presenceData struct {
+	Event     string       `json:"event"`
+	Username  string       `json:"username,omitempty"`
+	Usernames []string     `json:"usernames,omitempty"`
+	Typing    []typingData `json:"typing,omitempty"`
+}
+
+type typingData struct {
+	Username string `json:"username"`
+	ColumnId string `json:"columnId"`
+	Typing   bool   `json:"typing"`
+}
+
+type typingKey struct {
+	retroId, username, columnId string
+}
+
+// typists tracks the users that are typing in each column.
+type typists struct {
+	mu     sync.Mutex
+	active map[typingKey]*typist
+}
+
+// typist shows that a user is typing until the timer expires. In anonymous
+// retros the name shown is a pseudonym that is new each time they start typing,
+// so that what they type can not be linked to them, or to what else they type.
+type typist struct {
+	timer *time.Timer
+	name  string
+}
+
+func registerPresenceHandlers(r *Room, mux *sock.Server) {
+	mux.OnLeave(r.leavePresence)
+
+	mux.Handle("typing", r.inRetro("typing", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			ColumnId string `json:"columnId"`
+			Typing   bool   `json:"typing"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("typing:", err)
+			return
+		}
+
+		if args.ColumnId == "" {
+			sendError(conn, "typing", errBadRequest)
+			return
+		}
+
+		r.setTyping(typingKey{conn.RetroId, conn.Name, args.ColumnId}, args.Typing)
+	}))
+}
+
+// announcePresence tells the retro the connection has joined that the user is
+// present, if they were not already, and sends the connection everyone who is
+// present.
+func (r *Room) announcePresence(conn *sock.Conn, wasPresent bool) {
+	if !wasPresent && conn.Name != "" {
+		conn.Notify("", "presence", presenceData{Event: presenceJoin, Username: conn.Name})
+	}
+
+	conn.Send("", "presence", presenceData{
+		Event:     presenceSnapshot,
+		Usernames: r.Server.Present(conn.RetroId),
+		Typing:    r.typingIn(conn.RetroId),
+	})
+}
+
+// leavePresence tells the retro that the user has left, once they have no
+// connections left to it. In anonymous retros their typing indicators are left
+// to expire, as stopping them as the user leaves would show who was typing.
+func (r *Room) leavePresence(conn *sock.Conn, retroId string) {
+	if conn.Name == "" || contains(r.Server.Present(retroId), conn.Name) {
+		return
+	}
+
+	if !r.isAnonymous(retroId) {
+		r.typists.mu.Lock()
+		for key := range r.typists.active {
+			if key.retroId == retroId && key.username == conn.Name {
+				r.stopTyping(key)
+			}
+		}
+		r.typists.mu.Unlock()
+	}
+
+	r.Server.NotifyRetro(retroId, "", "presence", presenceData{Event: presenceLeave, Username: conn.Name})
+}
+
+// setTyping starts, or refreshes, the typing indicator for key. Changes are
+// broadcast to the retro, refreshing an indicator that is shown is not.
+func (r *Room) setTyping(key typingKey, typing bool) {
+	r.typists.mu.Lock()
+	defer r.typists.mu.Unlock()
+
+	current, ok := r.typists.active[key]
+	if !typing {
+		if ok {
+			r.stopTyping(key)
+		}
+		return
+	}
+
+	if ok {
+		current.timer.Reset(typingTimeout)
+		return
+	}
+
+	current = &typist{name: key.username}
+	if r.isAnonymous(key.retroId) {
+		current.name = "anonymous-" + strId()[:8]
+	}
+	current.timer = time.AfterFunc(typingTimeout, func() {
+		r.typists.mu.Lock()
+		defer r.typists.mu.Unlock()
+
+		if r.typists.active[key] == current {
+			r.stopTyping(key)
+		}
+	})
+	r.typists.active[key] = current
+
+	r.Server.NotifyRetro(key.retroId, "", "typing", typingData{current.name, key.columnId, true})
+}
+
+// stopTyping removes the indicator for key. It must be called with
+// r.typists.mu held.
+func (r *Room) stopTyping(key typingKey) {
+	current := r.typists.active[key]
+	current.timer.Stop()
+	delete(r.typists.active, key)
+
+	r.Server.NotifyRetro(key.retroId, "", "typing", typingData{current.name, key.columnId, false})
+}
+
+// typingIn lists the users that are typing in the retro.
+func (r *Room) typingIn(retroId string) []typingData {
+	r.typists.mu.Lock()
+	defer r.typists.mu.Unlock()
+
+	var typing []typingData
+	for key, current := range r.typists.active {
+		if key.retroId == retroId {
+			typing = append(typing, typingData{current.name, key.columnId, true})
+		}
+	}
+
+	sort.Slice(typing, func(i, j int) bool {
+		if typing[i].Username != typing[j].Username {
+			return typing[i].Username < typing[j].Username
+		}
+		return typing[i].ColumnId < typing[j].ColumnId
+	})
+
+	return typing
+}
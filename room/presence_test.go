@@ -0,0 +1,84 @@
+package room
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTypingInAnonymousRetro(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	retroId, columns := alice.createRetro("bob")
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	bob.expect("presence")
+	alice.rest()
+	bob.rest()
+
+	typing := func() typingData {
+		bob.send("typing", map[string]interface{}{"columnId": columns[0].ColumnId, "typing": true})
+		var data typingData
+		alice.expect("typing", &data)
+		bob.send("typing", map[string]interface{}{"columnId": columns[0].ColumnId, "typing": false})
+		alice.expect("typing")
+		return data
+	}
+
+	if data := typing(); data.Username != "bob" {
+		t.Fatalf("expected bob to be typing, was %s", data.Username)
+	}
+
+	alice.send("setAnonymous", anonymousData{Anonymous: true})
+	alice.expect("anonymous")
+
+	first := typing()
+	if first.Username == "bob" || !strings.HasPrefix(first.Username, "anonymous-") {
+		t.Fatalf("expected a pseudonym to be typing, was %s", first.Username)
+	}
+	if second := typing(); second.Username == first.Username {
+		t.Fatalf("expected a new pseudonym each time, was %s twice", first.Username)
+	}
+}
+
+func TestLeavingAnonymousRetroDoesNotShowTypist(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	retroId, columns := alice.createRetro("bob")
+	alice.send("setAnonymous", anonymousData{Anonymous: true})
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	bob.expect("presence")
+	alice.rest()
+	bob.rest()
+
+	bob.send("typing", map[string]interface{}{"columnId": columns[0].ColumnId, "typing": true})
+	var typist typingData
+	alice.expect("typing", &typist)
+
+	bob.ws.Close()
+
+	var left bool
+	for _, msg := range alice.rest() {
+		switch msg.Op {
+		case "presence":
+			var presence presenceData
+			json.Unmarshal([]byte(msg.Data), &presence)
+			left = left || (presence.Event == presenceLeave && presence.Username == "bob")
+		case "typing":
+			t.Errorf("expected typing not to change as bob left, was sent %s", msg.Data)
+		}
+		if strings.Contains(msg.Data, typist.Username) && strings.Contains(msg.Data, "bob") {
+			t.Errorf("expected no message to link %s to bob, was sent %s", typist.Username, msg.Data)
+		}
+	}
+	if !left {
+		t.Fatal("expected to be told that bob left")
+	}
+}
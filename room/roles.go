@@ -0,0 +1,169 @@
+package room
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// roleRules lists the least privileged role that can use an op. Ops that are not
+// listed can be used by anyone in the retro, including observers. The stage op
+// checks the role itself, so that it can tell the client the current stage.
+var roleRules = map[string]string{
+	"add":            database.RoleParticipant,
+	"edit":           database.RoleParticipant,
+	"move":           database.RoleParticipant,
+	"reveal":         database.RoleParticipant,
+	"group":          database.RoleParticipant,
+	"ungroup":        database.RoleParticipant,
+	"vote":           database.RoleParticipant,
+	"unvote":         database.RoleParticipant,
+	"delete":         database.RoleParticipant,
+	"undo":           database.RoleParticipant,
+	"typing":         database.RoleParticipant,
+	"addAction":      database.RoleParticipant,
+	"assignAction":   database.RoleParticipant,
+	"completeAction": database.RoleParticipant,
+	"addParticipant": database.RoleParticipant,
+	"saveTemplate":   database.RoleParticipant,
+
+	"setVoteBudget":     database.RoleFacilitator,
+	"setAnonymous":      database.RoleFacilitator,
+	"revealColumn":      database.RoleFacilitator,
+	"addColumn":         database.RoleFacilitator,
+	"renameColumn":      database.RoleFacilitator,
+	"reorderColumns":    database.RoleFacilitator,
+	"deleteColumn":      database.RoleFacilitator,
+	"deleteParticipant": database.RoleFacilitator,
+	"addGroup":          database.RoleFacilitator,
+	"deleteGroup":       database.RoleFacilitator,
+	"startTimer":        database.RoleFacilitator,
+	"pauseTimer":        database.RoleFacilitator,
+	"stopTimer":         database.RoleFacilitator,
+
+	"setRole":     database.RoleOwner,
+	"createShare": database.RoleOwner,
+	"listShares":  database.RoleOwner,
+	"revokeShare": database.RoleOwner,
+}
+
+type roleData struct {
+	RetroId  string `json:"retroId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func registerRoleHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("setRole", r.participant("setRole", func(conn *sock.Conn, data []byte) {
+		var args roleData
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("setRole:", err)
+			return
+		}
+
+		if !contains(database.Roles, args.Role) || args.Username == conn.Name {
+			sendError(conn, "setRole", errBadRequest)
+			return
+		}
+
+		role, err := r.db.GetRole(args.RetroId, args.Username)
+		if err != nil {
+			sendError(conn, "setRole", notFound(err))
+			return
+		}
+		if role == database.RoleOwner {
+			sendError(conn, "setRole", errBadRequest)
+			return
+		}
+
+		if err := r.db.SetRole(args.RetroId, args.Username, args.Role); err != nil {
+			log.Println("setRole db:", err)
+			return
+		}
+		r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name, args.Username}, conn.Name, "role", args)
+
+		// There is only one owner, so giving the role to someone else makes the
+		// current owner a facilitator.
+		if args.Role == database.RoleOwner {
+			if err := r.db.SetRole(args.RetroId, conn.Name, database.RoleFacilitator); err != nil {
+				log.Println("setRole db:", err)
+				return
+			}
+			r.Server.BroadcastRetroUsers(args.RetroId, []string{conn.Name, args.Username}, conn.Name, "role", roleData{args.RetroId, conn.Name, database.RoleFacilitator})
+		}
+	}))
+}
+
+// checkRole makes sure that username has at least the role given in the retro.
+func (r *Room) checkRole(retroId, username, least string) error {
+	role, err := r.db.GetRole(retroId, username)
+	if err == sql.ErrNoRows {
+		joined, err := r.joinByGroup(retroId, username)
+		if err != nil {
+			return err
+		}
+		if !joined {
+			return errForbidden
+		}
+		role = database.RoleParticipant
+	} else if err != nil {
+		return err
+	}
+
+	if !hasRole(role, least) {
+		switch least {
+		case database.RoleOwner:
+			return errNotOwner
+		case database.RoleFacilitator:
+			return errNotFacilitator
+		default:
+			return errReadOnly
+		}
+	}
+
+	return nil
+}
+
+// canChangeCard checks that username wrote all of the card's contents, or is
+// able to change any card in the retro.
+func (r *Room) canChangeCard(retroId, username string, state *database.CardState) error {
+	if state != nil {
+		wroteAll := true
+		for _, content := range state.Contents {
+			if content.Author != username {
+				wroteAll = false
+			}
+		}
+
+		if wroteAll {
+			return nil
+		}
+	}
+
+	return r.checkRole(retroId, username, database.RoleFacilitator)
+}
+
+// hasRole checks that role is at least as privileged as least.
+func hasRole(role, least string) bool {
+	rank := func(role string) int {
+		for i, r := range database.Roles {
+			if r == role {
+				return i
+			}
+		}
+		return -1
+	}
+
+	return rank(role) >= rank(least)
+}
+
+func requiredRole(op string) string {
+	if role, ok := roleRules[op]; ok {
+		return role
+	}
+
+	return database.RoleObserver
+}
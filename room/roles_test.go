@@ -0,0 +1,44 @@
+package room
+
+import (
+	"testing"
+
+	"hawx.me/code/retro/database"
+)
+
+func TestGivingAwayOwnership(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	retroId, _ := alice.createRetro("bob")
+	alice.rest()
+	bob.rest()
+
+	var failed errorData
+	bob.send("setRole", roleData{RetroId: retroId, Username: "alice", Role: database.RoleObserver})
+	bob.expect("error", &failed)
+	if failed.Error != errNotOwner.Error() {
+		t.Fatalf("expected only the owner to give roles, was %s", failed.Error)
+	}
+
+	alice.send("setRole", roleData{RetroId: retroId, Username: "bob", Role: database.RoleOwner})
+	alice.expect("role")
+	alice.expect("role")
+
+	roles, err := room.db.GetRoles(retroId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles["bob"] != database.RoleOwner || roles["alice"] != database.RoleFacilitator {
+		t.Fatalf("expected bob to own the retro and alice to facilitate it, was %v", roles)
+	}
+
+	alice.send("setRole", roleData{RetroId: retroId, Username: "bob", Role: database.RoleObserver})
+	alice.expect("error", &failed)
+	if failed.Error != errNotOwner.Error() {
+		t.Fatalf("expected alice to no longer give roles, was %s", failed.Error)
+	}
+}
@@ -1,7 +1,8 @@
 package room
 
 import (
-	"errors"
+	"database/sql"
+	"log"
 	"net/http"
 	"sync"
 	"time"
@@ -16,86 +17,144 @@ import (
 
 type Room struct {
 	Server *sock.Server
-	db     *database.Database
+	db     database.Storage
 
 	mu    sync.RWMutex
 	users map[string]string
+
+	typists typists
+	timers  timers
 }
 
 type Config struct {
 	HasGitHub    bool
 	HasOffice365 bool
 	HasTest      bool
+
+	// OIDCName is the name of the OpenID Connect provider to sign-in with, or
+	// empty if there is not one.
+	OIDCName string
+
+	// DefaultTemplate is the id of the template to use when a retro is created
+	// without choosing one.
+	DefaultTemplate string
 }
 
-func New(config Config, db *database.Database) *Room {
+func New(config Config, db database.Storage) *Room {
 	room := &Room{
 		db:     db,
 		Server: sock.NewServer(),
+		typists: typists{
+			active: map[typingKey]*typist{},
+		},
+		timers: timers{
+			expiry: map[string]*time.Timer{},
+		},
 	}
 
 	registerHandlers(config, room, room.Server)
+	room.restoreTimers()
 
 	return room
 }
 
-func (r *Room) AddUser(username string) (string, error) {
+// AddUser creates the user if they do not exist, and starts a session for them.
+func (r *Room) AddUser(username string) (tokensData, error) {
+	_, err := r.db.GetUser(username)
+	isNew := err == sql.ErrNoRows
+
 	r.db.EnsureUser(username, strId())
 	user, err := r.db.GetUser(username)
 	if err != nil {
-		return "", err
+		return tokensData{}, err
 	}
 
-	token, err := tokenForUser(user.Username, user.Secret)
-	if err != nil {
-		return "", err
+	if isNew {
+		r.Server.Broadcast("", "user", userData{user.Username})
 	}
-	return string(token), err
+
+	return r.startSession(user)
 }
 
-func (r *Room) IsUser(user, token string) bool {
-	found, err := r.db.GetUser(user)
+// checkToken makes sure that the access token was issued to the user, for a
+// session that has not ended. It returns errTokenExpired if the token is valid
+// but has expired.
+func (r *Room) checkToken(username, token string) error {
+	user, err := r.db.GetUser(username)
+	if err != nil {
+		return errBadAuth
+	}
 
 	parsedToken, err := jws.ParseJWT([]byte(token))
 	if err != nil {
-		return false
+		return errBadAuth
 	}
 
-	return verifyTokenIsForUser(user, found.Secret, parsedToken)
+	if err := verifyTokenIsForUser(username, user.Secret, parsedToken); err != nil {
+		return err
+	}
+
+	sessionId, _ := parsedToken.Claims().Get("sid").(string)
+	session, err := r.db.GetSession(sessionId)
+	if err != nil || session.Username != username {
+		return errBadAuth
+	}
+
+	// An expired session can not be refreshed, so the user must sign in again.
+	if time.Now().After(session.ExpiresAt) {
+		return errBadAuth
+	}
+
+	return nil
 }
 
-func (room *Room) AuthCallback(w http.ResponseWriter, r *http.Request, allowed bool, user string) {
+func (room *Room) AuthCallback(w http.ResponseWriter, r *http.Request, allowed bool, user string, groups []string) {
 	if allowed {
-		idToken, err := room.AddUser(user)
+		tokens, err := room.AddUser(user)
+		if err == nil {
+			err = room.db.SetMemberships(user, groups)
+		}
 		if err != nil {
+			log.Println("AuthCallback", err)
 			http.Redirect(w, r, "/?error=could_not_create_user", http.StatusFound)
 		} else {
-			http.Redirect(w, r, "/?token="+idToken, http.StatusFound)
+			setRefreshCookie(w, r, tokens.RefreshToken)
+			http.Redirect(w, r, "/?token="+tokens.Token, http.StatusFound)
 		}
 	} else {
 		http.Redirect(w, r, "/?error=not_in_org", http.StatusFound)
 	}
 }
 
-func verifyTokenIsForUser(username, secret string, token jwt.JWT) bool {
-	validator := jwt.Validator{}
+// verifyTokenIsForUser checks that the token was signed with the user's secret,
+// and is for the user.
+func verifyTokenIsForUser(username, secret string, token jwt.JWT) error {
+	validator := &jwt.Validator{}
 	validator.SetAudience("retro.hawx.me")
 	validator.SetSubject(username)
 	validator.Fn = jwt.ValidateFunc(func(claims jwt.Claims) error {
 		if exp, ok := claims.Expiration(); !ok || time.Now().After(exp) {
-			return errors.New("token expired")
+			return errTokenExpired
 		}
 		return nil
 	})
 
-	return validator.Validate(token) == nil
+	switch err := token.Validate([]byte(secret), crypto.SigningMethodHS256, validator); err {
+	case nil:
+		return nil
+	case errTokenExpired, jwt.ErrTokenIsExpired:
+		return errTokenExpired
+	default:
+		return errBadAuth
+	}
 }
 
-func tokenForUser(username, secret string) ([]byte, error) {
+func tokenForUser(username, secret, sessionId string) ([]byte, error) {
 	claims := jws.Claims{}
 	claims.SetAudience("retro.hawx.me")
 	claims.SetSubject(username)
-	claims.SetExpiration(time.Now().Add(24 * time.Hour))
+	claims.SetExpiration(time.Now().Add(accessTokenExpiry))
+	claims.Set("sid", sessionId)
 
 	return jws.NewJWT(claims, crypto.SigningMethodHS256).Serialize([]byte(secret))
 }
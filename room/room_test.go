@@ -0,0 +1,230 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+var testDatabases int64
+
+type testRoom struct {
+	*Room
+	db  *database.Database
+	srv *httptest.Server
+}
+
+func newTestRoom(t *testing.T) *testRoom {
+	n := atomic.AddInt64(&testDatabases, 1)
+	db, err := database.Open(fmt.Sprintf("file:room%d?mode=memory&cache=shared", n))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetTemplate(database.Template{
+		Id:      "default",
+		Name:    "Default",
+		Columns: []string{"Start", "More", "Keep", "Less", "Stop"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	room := New(Config{HasTest: true, DefaultTemplate: "default"}, db)
+
+	return &testRoom{Room: room, db: db, srv: httptest.NewServer(room.Server)}
+}
+
+func (r *testRoom) Close() {
+	r.srv.Close()
+	r.db.Close()
+}
+
+type testClient struct {
+	t    *testing.T
+	ws   *websocket.Conn
+	auth *sock.MsgAuth
+}
+
+// connect signs in as username, waits for the server to say hello, and opens
+// the menu.
+func (r *testRoom) connect(t *testing.T, username string) *testClient {
+	tokens, err := r.AddUser(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(r.srv.URL, "http"), "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testClient{t: t, ws: ws, auth: &sock.MsgAuth{Username: username, Token: tokens.Token}}
+	c.expect("hello")
+	c.send("menu", struct{}{})
+	c.rest()
+	return c
+}
+
+func (c *testClient) send(op string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if err := websocket.JSON.Send(c.ws, sock.Msg{Auth: c.auth, Op: op, Data: string(data)}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) receive() (sock.Msg, bool) {
+	var msg sock.Msg
+	c.ws.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	err := websocket.JSON.Receive(c.ws, &msg)
+	return msg, err == nil
+}
+
+// expect skips messages until one with op is received, and decodes its data
+// into v if given.
+func (c *testClient) expect(op string, v ...interface{}) sock.Msg {
+	c.t.Helper()
+
+	for {
+		msg, ok := c.receive()
+		if !ok {
+			c.t.Fatalf("%s: did not receive %s", c.auth.Username, op)
+		}
+		if msg.Op == op {
+			if len(v) > 0 {
+				if err := json.Unmarshal([]byte(msg.Data), v[0]); err != nil {
+					c.t.Fatal(err)
+				}
+			}
+			return msg
+		}
+	}
+}
+
+// rest returns the messages received until nothing more is sent.
+func (c *testClient) rest() []sock.Msg {
+	var msgs []sock.Msg
+	for {
+		msg, ok := c.receive()
+		if !ok {
+			return msgs
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// createRetro creates a retro with the participants given, and joins it,
+// returning the retro's id and its columns.
+func (c *testClient) createRetro(participants ...string) (string, []columnData) {
+	c.t.Helper()
+
+	if participants == nil {
+		participants = []string{}
+	}
+
+	var retro retroData
+	c.send("createRetro", map[string]interface{}{"name": "Retro", "users": participants})
+	c.expect("retro", &retro)
+
+	var columns []columnData
+	c.send("joinRetro", map[string]string{"retroId": retro.Id})
+	for i := 0; i < 5; i++ {
+		var column columnData
+		c.expect("column", &column)
+		columns = append(columns, column)
+	}
+
+	return retro.Id, columns
+}
+
+func TestRetrosAreIsolated(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	_, aliceColumns := alice.createRetro()
+	_, bobColumns := bob.createRetro()
+	alice.rest()
+	bob.rest()
+
+	act := func(c *testClient, columns []columnData) string {
+		var card cardData
+		c.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "hello"})
+		c.expect("card", &card)
+		c.send("reveal", map[string]string{"columnId": columns[0].ColumnId, "cardId": card.CardId})
+		c.expect("reveal")
+		c.send("stage", map[string]string{"stage": Presenting})
+		c.expect("stage")
+		c.send("stage", map[string]string{"stage": Voting})
+		c.expect("stage")
+		c.send("vote", map[string]string{"cardId": card.CardId})
+		c.expect("vote")
+
+		return card.CardId
+	}
+
+	for _, test := range []struct {
+		name           string
+		actor, watcher *testClient
+		columns        []columnData
+	}{
+		{"alice", alice, bob, aliceColumns},
+		{"bob", bob, alice, bobColumns},
+	} {
+		cardId := act(test.actor, test.columns)
+
+		for _, msg := range test.watcher.rest() {
+			switch msg.Op {
+			case "card", "reveal", "stage", "vote":
+				t.Errorf("%s's %s was sent to the other retro", test.name, msg.Op)
+			}
+			if strings.Contains(msg.Data, cardId) {
+				t.Errorf("%s's card was sent to the other retro in %s", test.name, msg.Op)
+			}
+		}
+	}
+}
+
+func TestFailedChangesAreNotBroadcast(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	alice.send("createRetro", map[string]interface{}{"name": "Retro", "users": []string{"bob", "bob"}})
+	for _, msg := range alice.rest() {
+		if msg.Op == "retro" {
+			t.Fatalf("expected retro not to be created when a participant can not be added, was sent %s", msg.Data)
+		}
+	}
+
+	retroId, _ := alice.createRetro("bob")
+	alice.rest()
+	bob.rest()
+
+	alice.send("addParticipant", participantData{RetroId: retroId, Participant: "bob"})
+	var failed errorData
+	alice.expect("error", &failed)
+	if failed.Op != "addParticipant" {
+		t.Fatalf("expected addParticipant to fail, was %v", failed)
+	}
+	for _, msg := range bob.rest() {
+		if msg.Op == "addParticipant" {
+			t.Fatalf("expected a failed addParticipant not to be broadcast, was sent %s", msg.Data)
+		}
+	}
+}
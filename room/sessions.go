@@ -0,0 +1,175 @@
+package room
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// accessTokenExpiry is how long an access token can be used for, after which a
+// new one must be got with the refresh token. sessionExpiry is how long a
+// refresh token can go unused before the user must sign in again.
+const (
+	accessTokenExpiry = 15 * time.Minute
+	sessionExpiry     = 30 * 24 * time.Hour
+)
+
+// refreshCookie is the name of the cookie that holds the refresh token.
+const refreshCookie = "retro_refresh"
+
+// tokensData is given to a user when they sign in, or refresh their session.
+// The refresh token is only ever given in a cookie, so that it can not be read
+// by scripts or kept in the browser's history.
+type tokensData struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"-"`
+}
+
+func registerSessionHandlers(r *Room, mux *sock.Server) {
+	// logoutEverywhere ends every session for the user, so that all of their
+	// tokens stop working, and closes their connections.
+	mux.Handle("logoutEverywhere", r.signedIn("logoutEverywhere", func(conn *sock.Conn, data []byte) {
+		username := conn.Name
+
+		if err := r.db.SetSecret(username, strId()); err != nil {
+			log.Println("logoutEverywhere db:", err)
+			return
+		}
+		if err := r.db.DeleteSessions(username); err != nil {
+			log.Println("logoutEverywhere db:", err)
+			return
+		}
+
+		r.Server.Disconnect(func(c *sock.Conn) bool {
+			return c.Share == "" && c.Name == username
+		})
+	}))
+}
+
+// RefreshHandler swaps the refresh token in the request's cookie for a new
+// access token, which is returned, and refresh token, which replaces the cookie.
+// Each refresh token can only be used once, if one is used again its session is
+// ended as the token may have been stolen.
+func (room *Room) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshCookie); err == nil {
+		refreshToken = cookie.Value
+	}
+
+	tokens, err := room.refreshSession(refreshToken)
+	if err != nil {
+		if err != errBadRefresh {
+			log.Println("refresh", err)
+		}
+		http.Error(w, errBadRefresh.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	setRefreshCookie(w, r, tokens.RefreshToken)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// setRefreshCookie gives the refresh token to the browser in a cookie that is
+// only sent to /refresh, and only from retro's own pages. It is only sent over
+// HTTPS when retro is reached by HTTPS directly or through a proxy that sets
+// X-Forwarded-Proto.
+func setRefreshCookie(w http.ResponseWriter, r *http.Request, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    refreshToken,
+		Path:     "/refresh",
+		MaxAge:   int(sessionExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// startSession creates a session for the user, returning its first tokens.
+func (r *Room) startSession(user database.User) (tokensData, error) {
+	refreshToken, err := newToken()
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	now := time.Now()
+	session := database.Session{
+		Id:        strId(),
+		Username:  user.Username,
+		TokenHash: hashToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionExpiry),
+	}
+	if err := r.db.AddSession(session); err != nil {
+		return tokensData{}, err
+	}
+
+	token, err := tokenForUser(user.Username, user.Secret, session.Id)
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	return tokensData{Token: string(token), RefreshToken: refreshToken}, nil
+}
+
+func (r *Room) refreshSession(refreshToken string) (tokensData, error) {
+	if refreshToken == "" {
+		return tokensData{}, errBadRefresh
+	}
+
+	tokenHash := hashToken(refreshToken)
+	session, err := r.db.GetSessionByToken(tokenHash)
+	if err == sql.ErrNoRows {
+		return tokensData{}, errBadRefresh
+	}
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	if session.TokenHash != tokenHash {
+		log.Println("refresh token reused, ending session for", session.Username)
+		r.db.DeleteSession(session.Id)
+		return tokensData{}, errBadRefresh
+	}
+	if time.Now().After(session.ExpiresAt) {
+		r.db.DeleteSession(session.Id)
+		return tokensData{}, errBadRefresh
+	}
+
+	user, err := r.db.GetUser(session.Username)
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	newRefreshToken, err := newToken()
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	ok, err := r.db.RotateSession(session.Id, tokenHash, hashToken(newRefreshToken), time.Now().Add(sessionExpiry))
+	if err != nil {
+		return tokensData{}, err
+	}
+	if !ok {
+		return tokensData{}, errBadRefresh
+	}
+
+	token, err := tokenForUser(user.Username, user.Secret, session.Id)
+	if err != nil {
+		return tokensData{}, err
+	}
+
+	return tokensData{Token: string(token), RefreshToken: newRefreshToken}, nil
+}
@@ -0,0 +1,93 @@
+package room
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTokenForExpiredSession(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	tokens, err := room.AddUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.checkToken("alice", tokens.Token); err != nil {
+		t.Fatalf("expected token to be accepted, was %v", err)
+	}
+
+	session, err := room.db.GetSessionByToken(hashToken(tokens.RefreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := room.db.RotateSession(session.Id, session.TokenHash, hashToken("other"), time.Now().Add(-time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("could not expire session: %v", err)
+	}
+
+	if err := room.checkToken("alice", tokens.Token); err != errBadAuth {
+		t.Fatalf("expected %v for an expired session, was %v", errBadAuth, err)
+	}
+}
+
+func TestRefreshTokenIsOnlyGivenInCookie(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	w := httptest.NewRecorder()
+	room.AuthCallback(w, httptest.NewRequest("GET", "/oauth/test/callback", nil), true, "alice", nil)
+
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/?token=") || strings.Contains(location, "&") {
+		t.Fatalf("expected to be redirected with only the access token, was %s", location)
+	}
+
+	cookie := refreshCookieIn(t, w)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Path != "/refresh" {
+		t.Fatalf("expected an HttpOnly, SameSite cookie for /refresh, was %v", cookie)
+	}
+
+	req := httptest.NewRequest("POST", "/refresh", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	room.RefreshHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected refresh to succeed, was %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), cookie.Value) || strings.Contains(w.Body.String(), "refreshToken") {
+		t.Fatalf("expected the refresh token not to be in the body, was %s", w.Body)
+	}
+
+	next := refreshCookieIn(t, w)
+	if next.Value == cookie.Value || !next.Secure {
+		t.Fatalf("expected a new secure cookie, was %v", next)
+	}
+
+	req = httptest.NewRequest("POST", "/refresh", strings.NewReader("refreshToken="+next.Value))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	room.RefreshHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a refresh token outside of the cookie to be refused, was %d", w.Code)
+	}
+}
+
+func refreshCookieIn(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == refreshCookie {
+			return cookie
+		}
+	}
+
+	t.Fatal("expected a refresh cookie")
+	return nil
+}
@@ -0,0 +1,219 @@
+package room
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// defaultShareExpiry is how long a share token lasts if no expiry is given, and
+// maxShareExpiry is the longest that can be given.
+const (
+	defaultShareExpiry = 7 * 24 * time.Hour
+	maxShareExpiry     = 30 * 24 * time.Hour
+)
+
+// shareData describes a share token. Token is only sent to the owner when the
+// share is created.
+type shareData struct {
+	ShareId   string    `json:"shareId"`
+	RetroId   string    `json:"retroId"`
+	Token     string    `json:"token,omitempty"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Revoked   bool      `json:"revoked"`
+}
+
+type sharesData struct {
+	RetroId string      `json:"retroId"`
+	Shares  []shareData `json:"shares"`
+}
+
+func registerShareHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("createShare", r.participant("createShare", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			RetroId string `json:"retroId"`
+
+			// Hours is how long the share lasts, if it is zero the share lasts
+			// for a week.
+			Hours int `json:"hours"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("createShare:", err)
+			return
+		}
+
+		expiry := time.Duration(args.Hours) * time.Hour
+		if args.Hours == 0 {
+			expiry = defaultShareExpiry
+		}
+		if expiry < 0 || expiry > maxShareExpiry {
+			sendError(conn, "createShare", errBadRequest)
+			return
+		}
+
+		token, err := newToken()
+		if err != nil {
+			log.Println("createShare token:", err)
+			return
+		}
+
+		now := time.Now()
+		share := database.Share{
+			Id:        strId(),
+			Retro:     args.RetroId,
+			TokenHash: hashToken(token),
+			CreatedBy: conn.Name,
+			CreatedAt: now,
+			ExpiresAt: now.Add(expiry),
+		}
+
+		if err := r.db.AddShare(share); err != nil {
+			log.Println("createShare db:", err)
+			return
+		}
+
+		created := newShareData(share)
+		created.Token = token
+		conn.Send("", "share", created)
+	}))
+
+	mux.Handle("listShares", r.participant("listShares", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			RetroId string `json:"retroId"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("listShares:", err)
+			return
+		}
+
+		shares, err := r.db.GetShares(args.RetroId)
+		if err != nil {
+			log.Println("listShares db:", err)
+			return
+		}
+
+		list := sharesData{RetroId: args.RetroId, Shares: []shareData{}}
+		for _, share := range shares {
+			list.Shares = append(list.Shares, newShareData(share))
+		}
+
+		conn.Send("", "shares", list)
+	}))
+
+	mux.Handle("revokeShare", r.participant("revokeShare", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			RetroId string `json:"retroId"`
+			ShareId string `json:"shareId"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("revokeShare:", err)
+			return
+		}
+
+		share, err := r.db.RevokeShare(args.RetroId, args.ShareId)
+		if err != nil {
+			sendError(conn, "revokeShare", notFound(err))
+			return
+		}
+
+		r.Server.Disconnect(func(c *sock.Conn) bool {
+			return c.Share != "" && hashToken(c.Share) == share.TokenHash
+		})
+
+		conn.Send("", "share", newShareData(share))
+	}))
+}
+
+// isShare checks that the token is for a share that can still be used.
+func (r *Room) isShare(token string) bool {
+	_, err := r.validShare(token)
+	return err == nil
+}
+
+func (r *Room) validShare(token string) (database.Share, error) {
+	share, err := r.db.GetShareByToken(hashToken(token))
+	if err == sql.ErrNoRows {
+		return share, errForbidden
+	}
+	if err != nil {
+		return share, err
+	}
+
+	if share.Revoked || time.Now().After(share.ExpiresAt) {
+		return share, errForbidden
+	}
+
+	return share, nil
+}
+
+// checkShare makes sure that the share token lets the connection watch the
+// retro. Connections using a share token are observers.
+func (r *Room) checkShare(token, retroId, least string) error {
+	share, err := r.validShare(token)
+	if err != nil {
+		return err
+	}
+	if share.Retro != retroId {
+		return errForbidden
+	}
+	if !hasRole(database.RoleObserver, least) {
+		return errReadOnly
+	}
+
+	return nil
+}
+
+// closeOnExpiry closes the connection when the share token it is using expires,
+// as it will not send any messages that would be rejected.
+func (r *Room) closeOnExpiry(conn *sock.Conn) {
+	if conn.Share == "" {
+		return
+	}
+
+	share, err := r.validShare(conn.Share)
+	if err != nil {
+		return
+	}
+
+	token := conn.Share
+	time.AfterFunc(time.Until(share.ExpiresAt), func() {
+		r.Server.Disconnect(func(c *sock.Conn) bool {
+			return c.Share == token
+		})
+	})
+}
+
+func newShareData(share database.Share) shareData {
+	return shareData{
+		ShareId:   share.Id,
+		RetroId:   share.Retro,
+		CreatedBy: share.CreatedBy,
+		CreatedAt: share.CreatedAt,
+		ExpiresAt: share.ExpiresAt,
+		Revoked:   share.Revoked,
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package room
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+	"hawx.me/code/retro/sock"
+)
+
+// watch connects with the share token, and waits for the server to say hello.
+func (r *testRoom) watch(t *testing.T, token string) *testClient {
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(r.srv.URL, "http"), "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testClient{t: t, ws: ws, auth: &sock.MsgAuth{Share: token}}
+	c.expect("hello")
+	return c
+}
+
+func TestSharesAreReadOnlyAndCanBeRevoked(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	retroId, columns := alice.createRetro()
+	alice.rest()
+
+	var share shareData
+	alice.send("createShare", map[string]interface{}{"retroId": retroId, "hours": 1})
+	alice.expect("share", &share)
+	if share.Token == "" {
+		t.Fatal("expected the owner to be given the share's token")
+	}
+
+	watcher := room.watch(t, share.Token)
+	watcher.send("joinRetro", map[string]string{"retroId": retroId})
+	watcher.expect("column")
+	watcher.rest()
+
+	var failed errorData
+	watcher.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": "hello"})
+	watcher.expect("error", &failed)
+	if failed.Error != errReadOnly.Error() {
+		t.Fatalf("expected a share to be read only, was %s", failed.Error)
+	}
+
+	var shares sharesData
+	alice.send("listShares", map[string]string{"retroId": retroId})
+	alice.expect("shares", &shares)
+	if len(shares.Shares) != 1 || shares.Shares[0].Token != "" {
+		t.Fatalf("expected the share to be listed without its token, was %+v", shares.Shares)
+	}
+
+	alice.send("revokeShare", map[string]string{"retroId": retroId, "shareId": share.ShareId})
+	alice.expect("share", &share)
+	if !share.Revoked {
+		t.Fatal("expected the share to be revoked")
+	}
+	if _, ok := watcher.receive(); ok {
+		t.Fatal("expected the watcher to be disconnected")
+	}
+
+	watcher = room.watch(t, share.Token)
+	watcher.send("joinRetro", map[string]string{"retroId": retroId})
+	watcher.expect("error", &failed)
+	if failed.Error != errBadAuth.Error() {
+		t.Fatalf("expected a revoked share to be refused, was %s", failed.Error)
+	}
+}
@@ -0,0 +1,126 @@
+package room
+
+import (
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// protocolSnapshot is the first protocol version where clients are sent a
+// single retroSnapshot message when joining a retro. Clients that do not send a
+// protocol version with joinRetro are sent a message for each column, card,
+// content and action instead.
+const protocolSnapshot = 1
+
+type retroSnapshotData struct {
+	RetroId    string                `json:"retroId"`
+	Stage      string                `json:"stage"`
+	Anonymous  bool                  `json:"anonymous"`
+	Roles      map[string]string     `json:"roles"`
+	Groups     []string              `json:"groups"`
+	Columns    []columnData          `json:"columns"`
+	Cards      []cardData            `json:"cards"`
+	Contents   []snapshotContentData `json:"contents"`
+	Actions    []actionData          `json:"actions"`
+	VoteBudget voteBudgetData        `json:"voteBudget"`
+	Timer      timerData             `json:"timer"`
+}
+
+type snapshotContentData struct {
+	contentData
+	Author string `json:"author"`
+}
+
+// sendSnapshot sends everything in the retro to the connection, using a single
+// message for clients that support it.
+func sendSnapshot(conn *sock.Conn, snapshot database.RetroSnapshot, budget voteBudgetData, protocol int) {
+	if protocol < protocolSnapshot {
+		sendLegacySnapshot(conn, snapshot, budget)
+		return
+	}
+
+	cards := map[string]database.Card{}
+	for _, card := range snapshot.Cards {
+		cards[card.Id] = card
+	}
+
+	data := retroSnapshotData{
+		RetroId:    snapshot.Retro.Id,
+		Stage:      currentStage(snapshot.Retro.Stage),
+		Anonymous:  snapshot.Retro.Anonymous,
+		Roles:      snapshot.Roles,
+		Groups:     append([]string{}, snapshot.Groups...),
+		Columns:    []columnData{},
+		Cards:      []cardData{},
+		Contents:   []snapshotContentData{},
+		Actions:    []actionData{},
+		VoteBudget: budget,
+		Timer:      newTimerData(snapshot.Timer),
+	}
+
+	for _, column := range snapshot.Columns {
+		data.Columns = append(data.Columns, columnData{column.Id, column.Name, column.Order})
+	}
+	for _, card := range snapshot.Cards {
+		data.Cards = append(data.Cards, cardData{card.Column, card.Id, card.Revealed, card.Votes, card.TotalVotes})
+	}
+	for _, content := range snapshot.Contents {
+		card := cards[content.Card]
+
+		data.Contents = append(data.Contents, snapshotContentData{
+			contentFor(card.Revealed, content.Author, conn.Name,
+				contentData{card.Column, content.Card, content.Id, content.Text, false}),
+			authorFor(snapshot.Retro.Anonymous, content.Author, conn.Name),
+		})
+	}
+	for _, action := range snapshot.Actions {
+		data.Actions = append(data.Actions, newActionData(action))
+	}
+
+	conn.Send("", "retroSnapshot", data)
+}
+
+// sendLegacySnapshot sends the retro in the order that clients without a
+// protocol version expect: each column followed by its cards and their
+// contents, then the vote budget, actions and timer.
+func sendLegacySnapshot(conn *sock.Conn, snapshot database.RetroSnapshot, budget voteBudgetData) {
+	if snapshot.Retro.Stage != "" {
+		conn.Send("", "stage", stageData{snapshot.Retro.Stage})
+	}
+	if snapshot.Retro.Anonymous {
+		conn.Send("", "anonymous", anonymousData{true})
+	}
+
+	cards := map[string][]database.Card{}
+	for _, card := range snapshot.Cards {
+		cards[card.Column] = append(cards[card.Column], card)
+	}
+
+	contents := map[string][]database.Content{}
+	for _, content := range snapshot.Contents {
+		contents[content.Card] = append(contents[content.Card], content)
+	}
+
+	for _, column := range snapshot.Columns {
+		conn.Send("", "column", columnData{column.Id, column.Name, column.Order})
+
+		for _, card := range cards[column.Id] {
+			conn.Send("", "card", cardData{column.Id, card.Id, card.Revealed, card.Votes, card.TotalVotes})
+
+			for _, content := range contents[card.Id] {
+				author := authorFor(snapshot.Retro.Anonymous, content.Author, conn.Name)
+				conn.Send(author, "content", contentFor(card.Revealed, content.Author, conn.Name,
+					contentData{column.Id, card.Id, content.Id, content.Text, false}))
+			}
+		}
+	}
+
+	conn.Send("", "voteBudget", budget)
+
+	for _, action := range snapshot.Actions {
+		conn.Send("", "action", newActionData(action))
+	}
+
+	if snapshot.Timer != nil {
+		conn.Send("", "timer", newTimerData(snapshot.Timer))
+	}
+}
@@ -0,0 +1,94 @@
+package room
+
+import "hawx.me/code/retro/database"
+
+// The stages that a retro moves through. A retro without a stage is Thinking.
+const (
+	Thinking   = "Thinking"
+	Presenting = "Presenting"
+	Grouping   = "Grouping"
+	Voting     = "Voting"
+	Discussing = "Discussing"
+	Done       = "Done"
+)
+
+// stages lists every stage in order.
+var stages = []string{Thinking, Presenting, Grouping, Voting, Discussing, Done}
+
+// transitions lists the stages that can be moved to from each stage. A retro
+// can go forward or back a stage, and Grouping can be skipped.
+var transitions = map[string][]string{
+	Thinking:   {Presenting},
+	Presenting: {Thinking, Grouping, Voting},
+	Grouping:   {Presenting, Voting},
+	Voting:     {Grouping, Presenting, Discussing},
+	Discussing: {Voting, Done},
+	Done:       {Discussing},
+}
+
+// stageRules lists the stages that an op can be used in. Ops that are not listed
+// can be used in any stage.
+var stageRules = map[string][]string{
+	"add":     {Thinking, Presenting, Grouping, Voting, Discussing},
+	"group":   {Grouping},
+	"ungroup": {Grouping},
+	"vote":    {Voting},
+	"unvote":  {Voting},
+	"undo":    {Thinking, Presenting, Grouping, Voting, Discussing},
+
+	// saveTemplate is not checked by the guard, as the retro does not have to be
+	// joined, so checks the stage itself.
+	"saveTemplate": {Done},
+}
+
+// checkTransition makes sure that username can move the retro to the stage.
+func (r *Room) checkTransition(username string, retro database.Retro, stage string) error {
+	if err := r.checkFacilitator(retro.Id, username); err != nil {
+		return err
+	}
+
+	if !canTransition(retro.Stage, stage) {
+		return errBadTransition
+	}
+
+	return nil
+}
+
+func currentStage(stage string) string {
+	if stage == "" {
+		return Thinking
+	}
+	return stage
+}
+
+// nextStage gives the stage after the one given, or an empty string if it is
+// the last stage.
+func nextStage(stage string) string {
+	for i, s := range stages[:len(stages)-1] {
+		if s == currentStage(stage) {
+			return stages[i+1]
+		}
+	}
+
+	return ""
+}
+
+func canTransition(from, to string) bool {
+	return contains(transitions[currentStage(from)], to)
+}
+
+func allowedInStage(op, stage string) bool {
+	stages, ok := stageRules[op]
+
+	return !ok || contains(stages, currentStage(stage))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
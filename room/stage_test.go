@@ -0,0 +1,64 @@
+package room
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStageChanges(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	bob := room.connect(t, "bob")
+
+	retroId, _ := alice.createRetro("bob")
+	bob.send("joinRetro", map[string]string{"retroId": retroId})
+	alice.rest()
+	bob.rest()
+
+	changeStage := func(c *testClient, to string) (string, string) {
+		c.send("stage", stageData{to})
+
+		var failed errorData
+		var stage stageData
+		for _, msg := range c.rest() {
+			switch msg.Op {
+			case "error":
+				json.Unmarshal([]byte(msg.Data), &failed)
+			case "stage":
+				json.Unmarshal([]byte(msg.Data), &stage)
+			}
+		}
+		return stage.Stage, failed.Error
+	}
+
+	if stage, err := changeStage(bob, Presenting); err != errNotFacilitator.Error() || stage != Thinking {
+		t.Fatalf("expected a participant to be refused and told the stage is %s, was %s and %s", Thinking, err, stage)
+	}
+	if stage, err := changeStage(alice, Voting); err != errBadTransition.Error() || stage != Thinking {
+		t.Fatalf("expected skipping to %s to be refused and told the stage is %s, was %s and %s", Voting, Thinking, err, stage)
+	}
+
+	if stage, err := changeStage(alice, Presenting); err != "" || stage != Presenting {
+		t.Fatalf("expected the stage to move to %s, was %s and %s", Presenting, err, stage)
+	}
+	var stage stageData
+	bob.expect("stage", &stage)
+	if stage.Stage != Presenting {
+		t.Fatalf("expected bob to be told the stage is %s, was %s", Presenting, stage.Stage)
+	}
+
+	// Grouping can be skipped
+	if stage, err := changeStage(alice, Voting); err != "" || stage != Voting {
+		t.Fatalf("expected the stage to move to %s, was %s and %s", Voting, err, stage)
+	}
+
+	retro, err := room.db.GetRetro(retroId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retro.Stage != Voting {
+		t.Fatalf("expected the stage to be stored as %s, was %s", Voting, retro.Stage)
+	}
+}
@@ -0,0 +1,60 @@
+package room
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSaveTemplate(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	retroId, columns := alice.createRetro()
+	alice.rest()
+
+	saveTemplate := func(name string) errorData {
+		alice.send("saveTemplate", map[string]string{"retroId": retroId, "name": name})
+
+		var err errorData
+		for _, msg := range alice.rest() {
+			if msg.Op == "template" {
+				return errorData{}
+			}
+			if msg.Op == "error" {
+				if e := json.Unmarshal([]byte(msg.Data), &err); e != nil {
+					t.Fatal(e)
+				}
+			}
+		}
+		return err
+	}
+
+	if err := saveTemplate("Mine"); err.Error != errWrongStage.Error() {
+		t.Fatalf("expected %v saving an unfinished retro, was %q", errWrongStage, err.Error)
+	}
+
+	if err := room.db.SetStage(retroId, Done); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTemplate(""); err.Error != errBadRequest.Error() {
+		t.Fatalf("expected %v saving without a name, was %q", errBadRequest, err.Error)
+	}
+	if err := saveTemplate("Mine"); err.Error != "" {
+		t.Fatalf("expected template to be saved, was %q", err.Error)
+	}
+
+	if err := room.db.RenameColumn(columns[1].ColumnId, columns[0].ColumnName); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTemplate("Duplicate"); err.Error != errBadRequest.Error() {
+		t.Fatalf("expected %v saving duplicate columns, was %q", errBadRequest, err.Error)
+	}
+
+	if err := room.db.RenameColumn(columns[1].ColumnId, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTemplate("Empty"); err.Error != errBadRequest.Error() {
+		t.Fatalf("expected %v saving an empty column name, was %q", errBadRequest, err.Error)
+	}
+}
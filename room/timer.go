@@ -0,0 +1,270 @@
+package room
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/sock"
+)
+
+// The states that a timer can be in.
+const (
+	timerRunning = "running"
+	timerPaused  = "paused"
+	timerStopped = "stopped"
+	timerExpired = "expired"
+)
+
+// maxTimer is the longest that a timer can be started for.
+const maxTimer = 24 * time.Hour
+
+// timerData describes a retro's timer. ServerTime is when the message was
+// created, so that clients can correct the deadline for the difference between
+// their clock and the server's. As they are only right when sent, timer messages
+// are not kept for connections that resume, which are sent the current timer
+// instead.
+type timerData struct {
+	State      string     `json:"state"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Remaining  int64      `json:"remaining"`
+	Advance    bool       `json:"advance"`
+	ServerTime time.Time  `json:"serverTime"`
+}
+
+// timers holds the functions that expire each running timer. The mutex is held
+// while a timer is changed, so that a change can not be lost to another made at
+// the same time, such as a pause made as the timer expires.
+type timers struct {
+	mu     sync.Mutex
+	expiry map[string]*time.Timer
+}
+
+func registerTimerHandlers(r *Room, mux *sock.Server) {
+	mux.Handle("startTimer", r.inRetro("startTimer", func(conn *sock.Conn, data []byte) {
+		var args struct {
+			// Seconds is how long the timer runs for. If it is zero a paused
+			// timer is continued.
+			Seconds int `json:"seconds"`
+
+			// Advance moves the retro to its next stage when the timer expires.
+			Advance bool `json:"advance"`
+		}
+		if err := json.Unmarshal(data, &args); err != nil {
+			log.Println("startTimer:", err)
+			return
+		}
+
+		r.timers.mu.Lock()
+		defer r.timers.mu.Unlock()
+
+		var timer database.Timer
+		if args.Seconds == 0 {
+			var err error
+			timer, err = r.db.GetTimer(conn.RetroId)
+			if err != nil || !timer.Paused {
+				sendError(conn, "startTimer", errBadRequest)
+				return
+			}
+			timer.Deadline = deadlineIn(timer.Remaining)
+		} else {
+			duration := time.Duration(args.Seconds) * time.Second
+			if duration < 0 || duration > maxTimer {
+				sendError(conn, "startTimer", errBadRequest)
+				return
+			}
+			timer = database.Timer{
+				Retro:    conn.RetroId,
+				Deadline: deadlineIn(duration),
+				Advance:  args.Advance,
+			}
+		}
+		timer.Paused = false
+		timer.Remaining = 0
+
+		if err := r.db.SetTimer(timer); err != nil {
+			log.Println("startTimer db:", err)
+			return
+		}
+		r.scheduleTimer(timer)
+
+		conn.Notify(conn.Name, "timer", newTimerData(&timer))
+	}))
+
+	mux.Handle("pauseTimer", r.inRetro("pauseTimer", func(conn *sock.Conn, data []byte) {
+		r.timers.mu.Lock()
+		defer r.timers.mu.Unlock()
+
+		timer, err := r.db.GetTimer(conn.RetroId)
+		if err != nil || timer.Paused {
+			sendError(conn, "pauseTimer", errBadRequest)
+			return
+		}
+
+		r.cancelTimer(conn.RetroId)
+
+		timer.Paused = true
+		timer.Remaining = time.Until(timer.Deadline)
+		if timer.Remaining < 0 {
+			timer.Remaining = 0
+		}
+
+		if err := r.db.SetTimer(timer); err != nil {
+			log.Println("pauseTimer db:", err)
+			return
+		}
+
+		conn.Notify(conn.Name, "timer", newTimerData(&timer))
+	}))
+
+	mux.Handle("stopTimer", r.inRetro("stopTimer", func(conn *sock.Conn, data []byte) {
+		r.timers.mu.Lock()
+		defer r.timers.mu.Unlock()
+
+		r.cancelTimer(conn.RetroId)
+
+		if err := r.db.DeleteTimer(conn.RetroId); err != nil {
+			log.Println("stopTimer db:", err)
+			return
+		}
+
+		conn.Notify(conn.Name, "timer", newTimerData(nil))
+	}))
+}
+
+// restoreTimers schedules the expiry of every running timer, so that timers
+// continue when the server is restarted.
+func (r *Room) restoreTimers() {
+	running, err := r.db.GetRunningTimers()
+	if err != nil {
+		log.Println("restoreTimers", err)
+		return
+	}
+
+	r.timers.mu.Lock()
+	defer r.timers.mu.Unlock()
+
+	for _, timer := range running {
+		r.scheduleTimer(timer)
+	}
+}
+
+// scheduleTimer expires the timer at its deadline, replacing any expiry already
+// scheduled for the retro. It must be called with r.timers.mu held.
+func (r *Room) scheduleTimer(timer database.Timer) {
+	if expiry, ok := r.timers.expiry[timer.Retro]; ok {
+		expiry.Stop()
+	}
+
+	r.timers.expiry[timer.Retro] = time.AfterFunc(time.Until(timer.Deadline), func() {
+		r.expireTimer(timer)
+	})
+}
+
+// cancelTimer stops the expiry scheduled for the retro. It must be called with
+// r.timers.mu held.
+func (r *Room) cancelTimer(retroId string) {
+	if expiry, ok := r.timers.expiry[retroId]; ok {
+		expiry.Stop()
+		delete(r.timers.expiry, retroId)
+	}
+}
+
+// expireTimer removes the timer, if it has not been changed since it was
+// scheduled, and tells the retro. If the timer was set to advance the retro it
+// is moved to the next stage.
+func (r *Room) expireTimer(timer database.Timer) {
+	if !r.removeTimer(timer) || !timer.Advance {
+		return
+	}
+
+	retro, err := r.db.GetRetro(timer.Retro)
+	if err != nil {
+		log.Println("expireTimer", timer.Retro, err)
+		return
+	}
+
+	if next := nextStage(retro.Stage); next != "" {
+		if err := r.db.SetStage(timer.Retro, next); err != nil {
+			log.Println("expireTimer", timer.Retro, err)
+			return
+		}
+		r.Server.BroadcastRetro(timer.Retro, "", "stage", stageData{next})
+	}
+}
+
+// removeTimer deletes the timer and tells the retro that it has expired, unless
+// it has been changed since it was scheduled. It returns false if the timer was
+// not removed.
+func (r *Room) removeTimer(timer database.Timer) bool {
+	r.timers.mu.Lock()
+	defer r.timers.mu.Unlock()
+
+	current, err := r.db.GetTimer(timer.Retro)
+	if err == sql.ErrNoRows || current.Paused || !current.Deadline.Equal(timer.Deadline) {
+		return false
+	}
+	if err != nil {
+		log.Println("expireTimer", timer.Retro, err)
+		return false
+	}
+
+	delete(r.timers.expiry, timer.Retro)
+	if err := r.db.DeleteTimer(timer.Retro); err != nil {
+		log.Println("expireTimer", timer.Retro, err)
+		return false
+	}
+
+	expired := newTimerData(nil)
+	expired.State = timerExpired
+	expired.Advance = timer.Advance
+	r.Server.NotifyRetro(timer.Retro, "", "timer", expired)
+
+	return true
+}
+
+// sendTimer sends the retro's current timer to conn, which has joined it.
+func (r *Room) sendTimer(conn *sock.Conn) {
+	timer, err := r.db.GetTimer(conn.RetroId)
+	if err == sql.ErrNoRows {
+		conn.Send("", "timer", newTimerData(nil))
+		return
+	}
+	if err != nil {
+		log.Println("sendTimer", conn.RetroId, err)
+		return
+	}
+
+	conn.Send("", "timer", newTimerData(&timer))
+}
+
+// deadlineIn gives the time after d, to the millisecond so that it is the same
+// once stored.
+func deadlineIn(d time.Duration) time.Time {
+	return time.Now().Add(d).Round(0).Truncate(time.Millisecond)
+}
+
+// newTimerData describes the timer, which is nil when there is no timer.
+func newTimerData(timer *database.Timer) timerData {
+	data := timerData{State: timerStopped, ServerTime: time.Now()}
+	if timer == nil {
+		return data
+	}
+
+	data.Advance = timer.Advance
+	if timer.Paused {
+		data.State = timerPaused
+		data.Remaining = int64(timer.Remaining / time.Millisecond)
+	} else {
+		data.State = timerRunning
+		data.Deadline = &timer.Deadline
+		if remaining := time.Until(timer.Deadline); remaining > 0 {
+			data.Remaining = int64(remaining / time.Millisecond)
+		}
+	}
+
+	return data
+}
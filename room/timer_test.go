@@ -0,0 +1,56 @@
+package room
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeIsSentCurrentTimer(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	retroId, _ := alice.createRetro()
+
+	away := room.connect(t, "alice")
+	var seq sequenceData
+	away.send("joinRetro", map[string]string{"retroId": retroId})
+	away.expect("sequence", &seq)
+	away.rest()
+
+	alice.send("startTimer", map[string]interface{}{"seconds": 60})
+	alice.expect("timer")
+	away.ws.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	resumedAt := time.Now()
+
+	back := room.connect(t, "alice")
+	back.send("resume", map[string]interface{}{"retroId": retroId, "log": seq.Log, "seq": seq.Seq})
+
+	var timers []timerData
+	for _, msg := range back.rest() {
+		if msg.Op == "timer" {
+			var timer timerData
+			if err := json.Unmarshal([]byte(msg.Data), &timer); err != nil {
+				t.Fatal(err)
+			}
+			timers = append(timers, timer)
+		}
+		if msg.Op == "sequence" && strings.Contains(msg.Data, `"snapshot":true`) {
+			t.Fatal("expected to resume, was sent a snapshot")
+		}
+	}
+
+	if len(timers) != 1 {
+		t.Fatalf("expected to be sent the timer once, was sent %v", timers)
+	}
+	if timers[0].State != timerRunning {
+		t.Fatalf("expected the timer to be running, was %s", timers[0].State)
+	}
+	if timers[0].ServerTime.Before(resumedAt) {
+		t.Fatalf("expected the timer to be sent as it is now, was from %v", timers[0].ServerTime)
+	}
+}
@@ -0,0 +1,69 @@
+package room
+
+import "testing"
+
+func TestUngroupMovesContentsAndTheirVotes(t *testing.T) {
+	room := newTestRoom(t)
+	defer room.Close()
+
+	alice := room.connect(t, "alice")
+	_, columns := alice.createRetro()
+	alice.rest()
+
+	add := func(text string) contentData {
+		var content contentData
+		alice.send("add", map[string]string{"columnId": columns[0].ColumnId, "cardText": text})
+		alice.expect("content", &content)
+		return content
+	}
+	stage := func(stage string) {
+		alice.send("stage", stageData{stage})
+		alice.expect("stage")
+	}
+
+	first := add("first")
+	second := add("second")
+
+	stage(Presenting)
+	stage(Voting)
+	alice.send("vote", map[string]string{"cardId": second.CardId})
+	alice.expect("vote")
+	stage(Grouping)
+
+	alice.send("group", groupData{CardFrom: second.CardId, CardTo: first.CardId})
+	alice.expect("group")
+	alice.rest()
+
+	var failed errorData
+	alice.send("ungroup", ungroupData{CardId: first.CardId, ColumnTo: columns[1].ColumnId, ContentIds: []string{first.ContentId, second.ContentId}})
+	alice.expect("error", &failed)
+	if failed.Error != errBadRequest.Error() {
+		t.Fatalf("expected ungrouping every content to be refused, was %s", failed.Error)
+	}
+
+	alice.send("ungroup", ungroupData{CardId: first.CardId, ColumnTo: columns[1].ColumnId, ContentIds: []string{second.ContentId}})
+	alice.expect("card")
+
+	cards, err := room.db.GetCards("alice", columns[1].ColumnId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 || cards[0].Votes != 1 {
+		t.Fatalf("expected a new card with the vote from the grouped card, was %+v", cards)
+	}
+	contents, err := room.db.GetContents(cards[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 1 || contents[0].Id != second.ContentId {
+		t.Fatalf("expected the new card to have the ungrouped content, was %+v", contents)
+	}
+
+	state, err := room.db.GetCardState(first.CardId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Contents) != 1 || state.Contents[0].Id != first.ContentId || len(state.Votes) != 0 {
+		t.Fatalf("expected the original card to keep only its own content, was %+v", state)
+	}
+}
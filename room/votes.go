@@ -0,0 +1,45 @@
+package room
+
+import (
+	"log"
+
+	"hawx.me/code/retro/sock"
+)
+
+// voteBudget works out how many votes username has left in the retro.
+func (r *Room) voteBudget(retroId, username string) (voteBudgetData, error) {
+	budget, err := r.db.GetVoteBudget(retroId)
+	if err != nil {
+		return voteBudgetData{}, err
+	}
+
+	data := voteBudgetData{
+		Votes:        budget.PerUser,
+		VotesPerCard: budget.PerCard,
+	}
+
+	if budget.PerUser > 0 {
+		used, err := r.db.CountVotes(retroId, username)
+		if err != nil {
+			return data, err
+		}
+
+		remaining := budget.PerUser - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		data.Remaining = &remaining
+	}
+
+	return data, nil
+}
+
+func (r *Room) sendVoteBudget(conn *sock.Conn) {
+	data, err := r.voteBudget(conn.RetroId, conn.Name)
+	if err != nil {
+		log.Println("voteBudget", err)
+		return
+	}
+
+	conn.Send("", "voteBudget", data)
+}
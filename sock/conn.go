@@ -7,11 +7,24 @@ import (
 )
 
 type Conn struct {
-	Name    string
-	Err     error
+	// Name is the user the connection is for. It, and Share, are set when the
+	// first message is received and do not change after.
+	Name string
+	Err  error
+
+	// RetroId is the retro the connection has joined, it is empty when the
+	// connection has not joined a retro. Use Join to change it.
 	RetroId string
-	hub     *hub
-	ws      *websocket.Conn
+
+	// Share is the share token the connection authenticated with, if it is
+	// watching a retro rather than taking part. Connections with a share token
+	// are only sent broadcasts for the retro they have joined.
+	Share string
+
+	identified bool
+
+	hub *hub
+	ws  *websocket.Conn
 }
 
 func (c *Conn) send(msg Msg) error {
@@ -19,27 +32,92 @@ func (c *Conn) send(msg Msg) error {
 }
 
 func (c *Conn) Send(id, op string, v interface{}) error {
-	data, err := json.Marshal(v)
+	msg, err := newMsg(id, op, v)
 	if err != nil {
 		return err
 	}
 
-	return c.send(Msg{
-		Id:   id,
-		Op:   op,
-		Data: string(data),
-	})
+	return c.send(msg)
 }
 
+// Join moves the connection into the room for retroId, so that it only receives
+// broadcasts for that retro. Passing an empty retroId leaves the current retro.
+// It returns the position of the latest event broadcast to the retro, which can
+// be used to Resume later.
+func (c *Conn) Join(retroId string) Position {
+	return c.hub.join(c, retroId)
+}
+
+// Resume moves the connection into the room for retroId, like Join, then sends
+// it every event broadcast to the retro after from. If some of those events are
+// no longer kept the connection is not moved and false is returned, the
+// connection should be sent everything in the retro instead.
+func (c *Conn) Resume(retroId string, from Position) (Position, bool) {
+	return c.hub.resume(c, retroId, from)
+}
+
+// Broadcast sends a message to every connection that has joined the same retro
+// as c.
 func (c *Conn) Broadcast(id, op string, v interface{}) {
-	data, err := json.Marshal(v)
+	msg, err := newMsg(id, op, v)
 	if err != nil {
 		return
 	}
 
-	c.hub.broadcast(Msg{
+	c.hub.broadcast(c.RetroId, msg)
+}
+
+// Notify sends a message to every connection that has joined the same retro as
+// c, like Broadcast, but the message is not kept for connections that resume.
+// It is for events that only matter at the time, like presence, which should be
+// sent again to connections that resume.
+func (c *Conn) Notify(id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	c.hub.notify(c.RetroId, msg)
+}
+
+// BroadcastFunc sends a message to every connection that has joined the same
+// retro as c, calling f to create the message for each connection. If f returns
+// false nothing is sent to that connection. f is called again for connections
+// that resume, before they have joined the retro, so should not use their
+// RetroId.
+func (c *Conn) BroadcastFunc(op string, f func(to *Conn) (id string, v interface{}, ok bool)) {
+	c.hub.broadcastFunc(c.RetroId, func(to *Conn) (Msg, bool) {
+		id, v, ok := f(to)
+		if !ok {
+			return Msg{}, false
+		}
+
+		msg, err := newMsg(id, op, v)
+		return msg, err == nil
+	})
+}
+
+// BroadcastAll sends a message to every connection on the server. It should
+// only be used for data that is not specific to a retro, like the list of
+// users.
+func (c *Conn) BroadcastAll(id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	c.hub.broadcastAll(msg)
+}
+
+func newMsg(id, op string, v interface{}) (Msg, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Msg{}, err
+	}
+
+	return Msg{
 		Id:   id,
 		Op:   op,
 		Data: string(data),
-	})
+	}, nil
 }
@@ -3,33 +3,100 @@
 package sock
 
 import (
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
 
+// lobby is the room that connections are in before they join a retro, or after
+// they have gone back to the menu.
+const lobby = ""
+
+// logSize is the number of events kept for each retro, so that connections that
+// resume can be sent the events they missed.
+const logSize = 256
+
+// logRetention is how long the events for a retro are kept after every
+// connection has left it.
+const logRetention = 10 * time.Minute
+
 type hub struct {
-	mu          sync.RWMutex
-	connections map[*Conn]struct{}
+	mu    sync.RWMutex
+	rooms map[string]map[*Conn]struct{}
+	logs  map[string]*eventLog
+
+	// onLeave, if set, is called after a connection has left a retro.
+	onLeave LeaveHandler
+}
+
+// A Position identifies an event in the log for a retro. Logs are only kept in
+// memory, so Log changes whenever a new log is started for the retro.
+type Position struct {
+	Log string `json:"log"`
+	Seq int64  `json:"seq"`
+}
+
+type eventLog struct {
+	id      string
+	seq     int64
+	entries []logEntry
+	expiry  *time.Timer
+}
+
+// logEntry is an event sent to a retro. If f is set the event was different for
+// each connection, so f is called again to create the event when replaying.
+type logEntry struct {
+	seq int64
+	msg Msg
+	f   func(*Conn) (Msg, bool)
+}
+
+func (l *eventLog) position() Position {
+	return Position{Log: l.id, Seq: l.seq}
+}
+
+func (l *eventLog) append(entry logEntry) {
+	if len(l.entries) == logSize {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:logSize-1]
+	}
+
+	l.entries = append(l.entries, entry)
+}
+
+// since returns the entries after seq, or false if some of them are no longer
+// in the log.
+func (l *eventLog) since(seq int64) ([]logEntry, bool) {
+	missed := l.seq - seq
+	if missed < 0 || missed > int64(len(l.entries)) {
+		return nil, false
+	}
+
+	return l.entries[int64(len(l.entries))-missed:], true
 }
 
 func newHub() *hub {
 	return &hub{
-		connections: map[*Conn]struct{}{},
+		rooms: map[string]map[*Conn]struct{}{},
+		logs:  map[string]*eventLog{},
 	}
 }
 
 // AddConnection adds a new connection to the hub, and returns the connection.
 func (h *hub) addConnection(ws *websocket.Conn) *Conn {
 	conn := &Conn{
-		Name: "",
-		Err:  nil,
-		ws:   ws,
-		hub:  h,
+		Name:    "",
+		Err:     nil,
+		RetroId: lobby,
+		ws:      ws,
+		hub:     h,
 	}
 
 	h.mu.Lock()
-	h.connections[conn] = struct{}{}
+	h.add(lobby, conn)
 	h.mu.Unlock()
 
 	return conn
@@ -37,15 +104,330 @@ func (h *hub) addConnection(ws *websocket.Conn) *Conn {
 
 func (h *hub) removeConnection(conn *Conn) {
 	h.mu.Lock()
-	delete(h.connections, conn)
+	retroId := conn.RetroId
+	h.remove(retroId, conn)
+	h.mu.Unlock()
+
+	h.left(conn, retroId)
+}
+
+// identify sets who the connection is for. The hub reads Name and Share while
+// holding h.mu, so they must be set with it held.
+func (h *hub) identify(conn *Conn, name, share string) {
+	h.mu.Lock()
+	conn.Name = name
+	conn.Share = share
+	conn.identified = true
 	h.mu.Unlock()
 }
 
-func (h *hub) broadcast(msg Msg) {
+// join moves the connection from the room it is currently in to the room for
+// retroId, returning the position of the latest event in the retro.
+func (h *hub) join(conn *Conn, retroId string) Position {
+	h.mu.Lock()
+	oldRetroId := conn.RetroId
+	h.move(conn, retroId)
+	var pos Position
+	if retroId != lobby {
+		pos = h.log(retroId).position()
+	}
+	h.mu.Unlock()
+
+	if oldRetroId != retroId {
+		h.left(conn, oldRetroId)
+	}
+
+	return pos
+}
+
+// resume moves the connection to the room for retroId and sends it the events
+// that have happened since from. If the events are no longer available the
+// connection is not moved, and false is returned.
+func (h *hub) resume(conn *Conn, retroId string, from Position) (Position, bool) {
+	// Events that were different for each connection are created before taking
+	// the lock to send them, as creating them can be slow. More events may be
+	// logged while that happens, so this repeats until all are ready.
+	created := map[int64]createdMsg{}
+	for {
+		h.mu.Lock()
+		log, ok := h.logs[retroId]
+		if !ok || log.id != from.Log {
+			h.mu.Unlock()
+			return Position{}, false
+		}
+
+		missed, ok := log.since(from.Seq)
+		if !ok {
+			h.mu.Unlock()
+			return Position{}, false
+		}
+
+		var pending []logEntry
+		for _, entry := range missed {
+			if _, done := created[entry.seq]; entry.f != nil && !done {
+				pending = append(pending, entry)
+			}
+		}
+
+		if len(pending) == 0 {
+			oldRetroId := conn.RetroId
+			h.move(conn, retroId)
+
+			for _, entry := range missed {
+				msg, ok := entry.msg, true
+				if entry.f != nil {
+					msg, ok = created[entry.seq].msg, created[entry.seq].ok
+				}
+				if ok {
+					msg.Seq = entry.seq
+					conn.send(msg)
+				}
+			}
+
+			pos := log.position()
+			h.mu.Unlock()
+
+			if oldRetroId != retroId {
+				h.left(conn, oldRetroId)
+			}
+
+			return pos, true
+		}
+		h.mu.Unlock()
+
+		for _, entry := range pending {
+			msg, ok := entry.f(conn)
+			created[entry.seq] = createdMsg{msg, ok}
+		}
+	}
+}
+
+type createdMsg struct {
+	msg Msg
+	ok  bool
+}
+
+func (h *hub) move(conn *Conn, retroId string) {
+	h.remove(conn.RetroId, conn)
+	conn.RetroId = retroId
+	h.add(retroId, conn)
+}
+
+func (h *hub) left(conn *Conn, retroId string) {
+	if retroId != lobby && h.onLeave != nil {
+		h.onLeave(conn, retroId)
+	}
+}
+
+// names returns the sorted, unique, names of the connections that have joined
+// retroId.
+func (h *hub) names(retroId string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := map[string]struct{}{}
+	names := []string{}
+	for conn := range h.rooms[retroId] {
+		if _, ok := seen[conn.Name]; ok || conn.Name == "" {
+			continue
+		}
+		seen[conn.Name] = struct{}{}
+		names = append(names, conn.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (h *hub) add(retroId string, conn *Conn) {
+	room, ok := h.rooms[retroId]
+	if !ok {
+		room = map[*Conn]struct{}{}
+		h.rooms[retroId] = room
+	}
+
+	room[conn] = struct{}{}
+
+	if log, ok := h.logs[retroId]; ok && log.expiry != nil {
+		log.expiry.Stop()
+		log.expiry = nil
+	}
+}
+
+func (h *hub) remove(retroId string, conn *Conn) {
+	room, ok := h.rooms[retroId]
+	if !ok {
+		return
+	}
+
+	delete(room, conn)
+	if len(room) == 0 {
+		delete(h.rooms, retroId)
+		h.expireLog(retroId)
+	}
+}
+
+// log returns the event log for retroId, starting a new log if there is not one.
+// It must be called with h.mu held.
+func (h *hub) log(retroId string) *eventLog {
+	log, ok := h.logs[retroId]
+	if !ok {
+		log = &eventLog{id: strconv.FormatInt(time.Now().UnixNano(), 36)}
+		h.logs[retroId] = log
+
+		if len(h.rooms[retroId]) == 0 {
+			h.expireLog(retroId)
+		}
+	}
+
+	return log
+}
+
+// expireLog removes the event log for retroId after logRetention, unless a
+// connection joins the retro before then.
+func (h *hub) expireLog(retroId string) {
+	log, ok := h.logs[retroId]
+	if !ok {
+		return
+	}
+
+	log.expiry = time.AfterFunc(logRetention, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.logs[retroId] == log && len(h.rooms[retroId]) == 0 {
+			delete(h.logs, retroId)
+		}
+	})
+}
+
+// broadcast sends the message to every connection that has joined retroId, and
+// records it in the retro's log.
+func (h *hub) broadcast(retroId string, msg Msg) {
+	h.broadcastUsers(retroId, nil, msg)
+}
+
+// broadcastUsers sends the message to every connection that has joined retroId,
+// recording it in the retro's log, and to every other connection for one of the
+// users, except those using a share token.
+func (h *hub) broadcastUsers(retroId string, users []string, msg Msg) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	for conn, _ := range h.connections {
+	if retroId != lobby {
+		log := h.log(retroId)
+		log.seq++
+		msg.Seq = log.seq
+		log.append(logEntry{seq: log.seq, msg: msg})
+	}
+
+	for conn := range h.rooms[retroId] {
 		conn.send(msg)
 	}
+
+	if len(users) == 0 {
+		return
+	}
+
+	msg.Seq = 0
+	for roomId, room := range h.rooms {
+		if roomId == retroId {
+			continue
+		}
+
+		for conn := range room {
+			if conn.Share == "" && isOneOf(conn.Name, users) {
+				conn.send(msg)
+			}
+		}
+	}
+}
+
+// broadcastFunc sends the message created by f to each connection that has
+// joined retroId, and records f in the retro's log.
+func (h *hub) broadcastFunc(retroId string, f func(*Conn) (Msg, bool)) {
+	// The messages are created before taking the lock to send them, as creating
+	// them can be slow. Connections that join in the meantime are not sent a
+	// message, as they will be sent the retro as it is after the change.
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.rooms[retroId]))
+	for conn := range h.rooms[retroId] {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	msgs := map[*Conn]Msg{}
+	for _, conn := range conns {
+		if msg, ok := f(conn); ok {
+			msgs[conn] = msg
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var seq int64
+	if retroId != lobby {
+		log := h.log(retroId)
+		log.seq++
+		seq = log.seq
+		log.append(logEntry{seq: seq, f: f})
+	}
+
+	for conn := range h.rooms[retroId] {
+		if msg, ok := msgs[conn]; ok {
+			msg.Seq = seq
+			conn.send(msg)
+		}
+	}
+}
+
+// notify sends the message to every connection that has joined retroId, without
+// recording it in the retro's log.
+func (h *hub) notify(retroId string, msg Msg) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for conn := range h.rooms[retroId] {
+		conn.send(msg)
+	}
+}
+
+// broadcastAll sends the message to every connection, regardless of the retro
+// it has joined, except those using a share token.
+func (h *hub) broadcastAll(msg Msg) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, room := range h.rooms {
+		for conn := range room {
+			if conn.Share == "" {
+				conn.send(msg)
+			}
+		}
+	}
+}
+
+// closeWhere closes every connection that match returns true for.
+func (h *hub) closeWhere(match func(*Conn) bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, room := range h.rooms {
+		for conn := range room {
+			if match(conn) {
+				conn.ws.Close()
+			}
+		}
+	}
+}
+
+func isOneOf(name string, names []string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,215 @@
+package sock
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+type testConn struct {
+	t    *testing.T
+	ws   *websocket.Conn
+	auth *MsgAuth
+}
+
+func newTestServer() (*Server, *httptest.Server) {
+	s := NewServer()
+	s.Auth(func(MsgAuth) error { return nil })
+	s.Handle("join", func(conn *Conn, data []byte) {
+		conn.Send("", "joined", conn.Join(strings.Trim(string(data), `"`)))
+	})
+	s.Handle("resume", func(conn *Conn, data []byte) {
+		var args struct {
+			RetroId string
+			From    Position
+		}
+		json.Unmarshal(data, &args)
+
+		if _, ok := conn.Resume(args.RetroId, args.From); !ok {
+			conn.Send("", "notResumed", nil)
+		}
+	})
+	s.Handle("say", func(conn *Conn, data []byte) {
+		conn.Broadcast(conn.Name, "said", string(data))
+	})
+	s.Handle("notify", func(conn *Conn, data []byte) {
+		conn.Notify(conn.Name, "notified", string(data))
+	})
+	s.Handle("present", func(conn *Conn, data []byte) {
+		retroId := conn.RetroId
+		conn.BroadcastFunc("present", func(to *Conn) (string, interface{}, bool) {
+			return to.Name, s.Present(retroId), true
+		})
+	})
+
+	return s, httptest.NewServer(s)
+}
+
+func dial(t *testing.T, srv *httptest.Server, username string) *testConn {
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testConn{t: t, ws: ws, auth: &MsgAuth{Username: username}}
+}
+
+func (c *testConn) send(op, data string) {
+	if err := websocket.JSON.Send(c.ws, Msg{Auth: c.auth, Op: op, Data: data}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testConn) join(retroId string) Position {
+	c.send("join", `"`+retroId+`"`)
+
+	var pos Position
+	json.Unmarshal([]byte(c.expect("joined").Data), &pos)
+	return pos
+}
+
+func (c *testConn) receive() (Msg, bool) {
+	var msg Msg
+	c.ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	err := websocket.JSON.Receive(c.ws, &msg)
+	return msg, err == nil
+}
+
+func (c *testConn) expect(op string) Msg {
+	c.t.Helper()
+
+	msg, ok := c.receive()
+	if !ok {
+		c.t.Fatalf("%s: did not receive %s", c.auth.Username, op)
+	}
+	if msg.Op != op {
+		c.t.Fatalf("%s: expected %s, received %s", c.auth.Username, op, msg.Op)
+	}
+
+	return msg
+}
+
+func (c *testConn) expectNothing() {
+	c.t.Helper()
+
+	if msg, ok := c.receive(); ok {
+		c.t.Fatalf("%s: expected nothing, received %s %s", c.auth.Username, msg.Op, msg.Data)
+	}
+}
+
+func TestBroadcastIsOnlySentToRetro(t *testing.T) {
+	s, srv := newTestServer()
+	defer srv.Close()
+
+	a := dial(t, srv, "a")
+	b := dial(t, srv, "b")
+	c := dial(t, srv, "c")
+	a.join("1")
+	b.join("2")
+	c.join("1")
+
+	a.send("say", `"hi"`)
+	if msg := a.expect("said"); msg.Seq != 1 {
+		t.Fatalf("expected seq 1, was %d", msg.Seq)
+	}
+	c.expect("said")
+	b.expectNothing()
+
+	s.BroadcastRetro("2", "", "said", "hello")
+	if msg := b.expect("said"); msg.Seq != 1 {
+		t.Fatalf("expected seq 1, was %d", msg.Seq)
+	}
+	a.expectNothing()
+	c.expectNothing()
+}
+
+func TestBroadcastRetroUsers(t *testing.T) {
+	s, srv := newTestServer()
+	defer srv.Close()
+
+	a := dial(t, srv, "a")
+	b := dial(t, srv, "b")
+	c := dial(t, srv, "c")
+	share := dial(t, srv, "b")
+	share.auth.Share = "token"
+	a.join("1")
+	b.join("")
+	c.join("2")
+	share.join("")
+
+	s.BroadcastRetroUsers("1", []string{"a", "b"}, "", "added", "b")
+	a.expect("added")
+	if msg := b.expect("added"); msg.Seq != 0 {
+		t.Fatalf("expected no seq outside of the retro, was %d", msg.Seq)
+	}
+	a.expectNothing()
+	c.expectNothing()
+	share.expectNothing()
+}
+
+func TestNotifyIsNotReplayed(t *testing.T) {
+	_, srv := newTestServer()
+	defer srv.Close()
+
+	a := dial(t, srv, "a")
+	b := dial(t, srv, "b")
+	a.join("1")
+	pos := b.join("1")
+	b.join("")
+
+	a.send("notify", `"typing"`)
+	a.expect("notified")
+	a.send("say", `"hi"`)
+	a.expect("said")
+	b.expectNothing()
+
+	data, _ := json.Marshal(map[string]interface{}{"retroId": "1", "from": pos})
+	b.send("resume", string(data))
+	if msg := b.expect("said"); msg.Seq != 1 {
+		t.Fatalf("expected seq 1, was %d", msg.Seq)
+	}
+	b.expectNothing()
+}
+
+func TestBroadcastFuncCreatesMessagesWithoutLocking(t *testing.T) {
+	_, srv := newTestServer()
+	defer srv.Close()
+
+	a := dial(t, srv, "a")
+	b := dial(t, srv, "b")
+	a.join("1")
+	pos := b.join("1")
+	b.join("")
+
+	// creating the message asks the hub who is present, which would not return
+	// if the hub was locked
+	a.send("present", `""`)
+	if msg := a.expect("present"); msg.Data != `["a"]` {
+		t.Fatalf("expected a to be present, was %s", msg.Data)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"retroId": "1", "from": pos})
+	b.send("resume", string(data))
+	if msg := b.expect("present"); msg.Seq != 1 || msg.Id != "b" {
+		t.Fatalf("expected message created for b at seq 1, was for %s at %d", msg.Id, msg.Seq)
+	}
+}
+
+func TestConnectionCanNotChangeUser(t *testing.T) {
+	_, srv := newTestServer()
+	defer srv.Close()
+
+	a := dial(t, srv, "a")
+	a.join("1")
+
+	a.auth.Username = "b"
+	a.send("say", `"hi"`)
+	if msg := a.expect("error"); msg.Data != `{"error":"bad_auth"}` {
+		t.Fatalf("expected bad_auth, was %s", msg.Data)
+	}
+	a.expectNothing()
+}
@@ -15,9 +15,17 @@ type Msg struct {
 
 	// Data is anything useful, encoded in a string, hopefully in JSON.
 	Data string `json:"data"`
+
+	// Seq is the position of the message in the log of events for a retro. It is
+	// only set on messages broadcast to a retro.
+	Seq int64 `json:"seq,omitempty"`
 }
 
 type MsgAuth struct {
 	Username string `json:"username"`
 	Token    string `json:"token"`
+
+	// Share is set, instead of Username and Token, by connections that are
+	// watching a retro using a share token.
+	Share string `json:"share,omitempty"`
 }
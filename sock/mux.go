@@ -9,7 +9,17 @@ import (
 
 type Handler func(conn *Conn, data []byte)
 type OnConnectHandler func(conn *Conn)
-type Authenticator func(MsgAuth) bool
+type LeaveHandler func(conn *Conn, retroId string)
+
+// Authenticator checks that a message is from who it claims. The text of any
+// error returned is sent to the client as the code of an "error" message, and
+// unless the error is ErrTokenExpired the connection is closed.
+type Authenticator func(MsgAuth) error
+
+// ErrTokenExpired is returned by an Authenticator when the message's token was
+// valid but has expired. The connection is kept open, so that the client can
+// carry on once it has a new token.
+var ErrTokenExpired = errors.New("token_expired")
 
 type mux struct {
 	// I'm trusting you not to insert handlers once Serve is called...
@@ -40,12 +50,26 @@ func (m *mux) serve(conn *Conn) error {
 			return err
 		}
 
-		if msg.Auth == nil || !m.authenticate(*msg.Auth) {
+		if msg.Auth == nil {
 			conn.Send("", "error", errorData{"bad_auth"})
 			return errors.New("BadAuth")
 		}
+		if err := m.authenticate(*msg.Auth); err != nil {
+			conn.Send("", "error", errorData{err.Error()})
+			if err == ErrTokenExpired {
+				continue
+			}
+			return errors.New("BadAuth")
+		}
 
-		conn.Name = msg.Auth.Username
+		// Who the connection is for is set by its first message, and can not be
+		// changed by later messages as it is read by other connections.
+		if !conn.identified {
+			conn.hub.identify(conn, msg.Auth.Username, msg.Auth.Share)
+		} else if msg.Auth.Username != conn.Name || msg.Auth.Share != conn.Share {
+			conn.Send("", "error", errorData{"bad_auth"})
+			return errors.New("BadAuth")
+		}
 
 		handler, ok := m.handlers[msg.Op]
 		if !ok {
@@ -33,6 +33,62 @@ func (s *Server) serve(ws *websocket.Conn) {
 	}
 }
 
+// BroadcastRetro sends a message to every connection that has joined retroId.
+func (s *Server) BroadcastRetro(retroId, id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	s.hub.broadcast(retroId, msg)
+}
+
+// NotifyRetro sends a message to every connection that has joined retroId, like
+// BroadcastRetro, but the message is not kept for connections that resume.
+func (s *Server) NotifyRetro(retroId, id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	s.hub.notify(retroId, msg)
+}
+
+// BroadcastRetroUsers sends a message to every connection that has joined
+// retroId, like BroadcastRetro, and also to the connections of the users given
+// wherever they are. It is for changes that the users need to see in their menu,
+// such as being added to the retro.
+func (s *Server) BroadcastRetroUsers(retroId string, users []string, id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	s.hub.broadcastUsers(retroId, users, msg)
+}
+
+// Present returns the names of the users with a connection that has joined
+// retroId.
+func (s *Server) Present(retroId string) []string {
+	return s.hub.names(retroId)
+}
+
+// Broadcast sends a message to every connection on the server, except those
+// using a share token.
+func (s *Server) Broadcast(id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	s.hub.broadcastAll(msg)
+}
+
+// Disconnect closes every connection that match returns true for.
+func (s *Server) Disconnect(match func(conn *Conn) bool) {
+	s.hub.closeWhere(match)
+}
+
 func (s *Server) Handle(op string, handler Handler) {
 	s.mux.handle(op, handler)
 }
@@ -44,3 +100,9 @@ func (s *Server) Auth(authenticate Authenticator) {
 func (s *Server) OnConnect(handler OnConnectHandler) {
 	s.mux.onConnect = &handler
 }
+
+// OnLeave sets a handler to be called when a connection leaves a retro, either
+// by joining another or by disconnecting.
+func (s *Server) OnLeave(handler LeaveHandler) {
+	s.hub.onLeave = handler
+}